@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/BetaLixT/gowebstd/externals/cntxt"
+	"github.com/BetaLixT/gowebstd/redact"
 	"go.uber.org/zap"
 )
 
@@ -23,6 +24,24 @@ func NewLoggerFactory() (*LoggerFactory, error) {
 	}, nil
 }
 
+// NewLoggerFactoryWithRedaction creates a logger factory whose loggers redact
+// fields according to the provided options before writing them
+func NewLoggerFactoryWithRedaction(
+	opts *redact.Options,
+) (*LoggerFactory, error) {
+	rdc, err := redact.NewRedactor(opts)
+	if err != nil {
+		return nil, err
+	}
+	lgr, err := zap.NewProduction(zap.WrapCore(redact.WrapCore(rdc)))
+	if err != nil {
+		return nil, err
+	}
+	return &LoggerFactory{
+		lgr: lgr,
+	}, nil
+}
+
 func (lf *LoggerFactory) Create(
 	c context.Context,
 ) *zap.Logger {
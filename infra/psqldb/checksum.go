@@ -0,0 +1,198 @@
+package psqldb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// ChecksumMode controls what happens when the checksum of an applied
+// migration doesn't match the checksum of its script
+type ChecksumMode int
+
+const (
+	// ChecksumWarn logs a warning and continues
+	ChecksumWarn ChecksumMode = iota
+	// ChecksumStrict fails with *ErrChecksumMismatch
+	ChecksumStrict
+	// ChecksumIgnore skips the verification
+	ChecksumIgnore
+)
+
+// Templates taking the qualified migrations table
+const (
+	upgradeMigrationChecksum = `
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS checksum text NULL`
+	setMigrationChecksum = `
+		UPDATE %s SET checksum = $2 WHERE key = $1`
+)
+
+// Checksum of the Up script, used to detect edits to applied migrations, edits
+// to an UpFunc can't be detected
+func (m MigrationScript) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrChecksumMismatch is returned in strict mode when an applied migration
+// was edited after it was applied
+type ErrChecksumMismatch struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf(
+		"migration %s checksum missmatch: applied %s, script %s",
+		e.Key,
+		e.Expected,
+		e.Actual,
+	)
+}
+
+// Adds the checksum column to migration tables created before checksums were
+// tracked and baselines the checksums of applied migrations that have none
+func upgradeChecksums(
+	ctx context.Context,
+	lgr *zap.Logger,
+	tx *sqlx.Tx,
+	opts *MigrationOptions,
+	migrations []MigrationScript,
+	exMigrs []migrationEntity,
+) error {
+	if _, err := tx.ExecContext(ctx, opts.query(upgradeMigrationChecksum)); err != nil {
+		return &ErrMigrationFailed{Key: "migration checksums", Err: err}
+	}
+	for idx := range exMigrs {
+		if exMigrs[idx].Checksum != nil || idx >= len(migrations) {
+			continue
+		}
+		sum := migrations[idx].Checksum()
+		lgr.Info(
+			"Baselining migration checksum",
+			zap.String("migration", exMigrs[idx].Key),
+		)
+		_, err := tx.ExecContext(
+			ctx,
+			opts.query(setMigrationChecksum),
+			exMigrs[idx].Key,
+			sum,
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: exMigrs[idx].Key, Err: err}
+		}
+		exMigrs[idx].Checksum = &sum
+	}
+	return nil
+}
+
+// Compares the checksums of applied migrations with their scripts
+func verifyChecksum(
+	lgr *zap.Logger,
+	mode ChecksumMode,
+	migr MigrationScript,
+	exMigr migrationEntity,
+) error {
+	if mode == ChecksumIgnore || exMigr.Checksum == nil {
+		return nil
+	}
+	sum := migr.Checksum()
+	if sum == *exMigr.Checksum {
+		return nil
+	}
+
+	if mode == ChecksumStrict {
+		return &ErrChecksumMismatch{
+			Key:      migr.Key,
+			Expected: *exMigr.Checksum,
+			Actual:   sum,
+		}
+	}
+	lgr.Warn(
+		"Applied migration was modified",
+		zap.String("migration", migr.Key),
+		zap.String("applied", *exMigr.Checksum),
+		zap.String("script", sum),
+	)
+	return nil
+}
+
+// RepairChecksums deliberately re-baselines the checksums of every applied
+// migration to the checksums of the provided scripts, use it after an applied
+// migration was intentionally edited
+func RepairChecksums(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) error {
+	return opts.withLock(ctx, lgr, db, func() error {
+		return repairChecksums(ctx, lgr, db, migrations, opts)
+	})
+}
+
+func repairChecksums(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, opts.query(upgradeMigrationChecksum)); err != nil {
+		return err
+	}
+	exMigrs, err := fetchMigrationHistory(ctx, tx, opts)
+	if err != nil {
+		return err
+	}
+
+	for idx := range exMigrs {
+		if idx >= len(migrations) || migrations[idx].Key != exMigrs[idx].Key {
+			expected := ""
+			if idx < len(migrations) {
+				expected = migrations[idx].Key
+			}
+			return &ErrKeyMismatch{
+				Index:    idx,
+				Expected: expected,
+				Actual:   exMigrs[idx].Key,
+			}
+		}
+
+		sum := migrations[idx].Checksum()
+		if exMigrs[idx].Checksum != nil && *exMigrs[idx].Checksum == sum {
+			continue
+		}
+		lgr.Info(
+			"Repairing migration checksum",
+			zap.String("migration", exMigrs[idx].Key),
+		)
+		_, err = tx.ExecContext(
+			ctx,
+			opts.query(setMigrationChecksum),
+			exMigrs[idx].Key,
+			sum,
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: exMigrs[idx].Key, Err: err}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,187 @@
+// Command migrate applies, rolls back and reports on psqldb migrations loaded
+// from a directory, meant to be used in deployment pipelines
+//
+//	migrate -conn <connection string> -dir <migrations dir> [flags] <command>
+//
+// Commands:
+//
+//	up        apply pending migrations
+//	down      roll back to -target (every migration with -all)
+//	status    report applied, pending, modified and unknown migrations
+//	plan      report the migrations up would apply (or down with -down)
+//	baseline  record migrations up to -target as applied without running them
+//
+// Migrations whose scripts start with a "-- psqldb:no-transaction" comment
+// are applied and rolled back outside of a transaction one statement at a
+// time, such as CREATE INDEX CONCURRENTLY
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb"
+	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	conn := flag.String(
+		"conn",
+		os.Getenv("DATABASE_URL"),
+		"connection string, defaults to $DATABASE_URL",
+	)
+	dir := flag.String("dir", "migrations", "migrations directory")
+	schema := flag.String("schema", "", "schema, defaults to public")
+	table := flag.String("table", "", "migrations table, defaults to migrations")
+	target := flag.String("target", "", "target migration key for down and baseline")
+	all := flag.Bool("all", false, "roll back every migration with down")
+	down := flag.Bool("down", false, "plan a roll back to -target instead")
+	strict := flag.Bool("strict", false, "fail on modified migrations")
+	perMigr := flag.Bool("tx-per-migration", false, "commit after every migration")
+	timeout := flag.Duration("timeout", 30*time.Minute, "overall timeout")
+	flag.Usage = func() {
+		fmt.Fprintln(
+			flag.CommandLine.Output(),
+			"usage: migrate [flags] up|down|status|plan|baseline",
+		)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return errors.New("expected a single command")
+	}
+	if *conn == "" {
+		return errors.New("no connection string provided")
+	}
+
+	migrations, err := psqldb.LoadMigrations(os.DirFS(*dir), ".")
+	if err != nil {
+		return err
+	}
+
+	lgr, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	defer lgr.Sync()
+
+	sdb, err := sqlx.Open("postgres", *conn)
+	if err != nil {
+		return err
+	}
+	defer sdb.Close()
+	db := tsqlx.NewTracedDB(sdb, &noopTracer{}, "migrate")
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	opts := &psqldb.MigrationOptions{
+		Schema:                  *schema,
+		MigrationsTable:         *table,
+		TransactionPerMigration: *perMigr,
+	}
+	if *strict {
+		opts.ChecksumMode = psqldb.ChecksumStrict
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		return psqldb.RunMigrationsWithOptions(ctx, lgr, db, migrations, opts)
+	case "down":
+		if *target == "" && !*all {
+			return errors.New("down requires -target or -all")
+		}
+		return psqldb.RollbackMigrationsWithOptions(
+			ctx, lgr, db, migrations, *target, opts,
+		)
+	case "status":
+		status, err := psqldb.Status(ctx, db, migrations, opts)
+		if err != nil {
+			return err
+		}
+		printStatus(status)
+		return nil
+	case "plan":
+		var keys []string
+		if *down {
+			if *target == "" && !*all {
+				return errors.New("plan -down requires -target or -all")
+			}
+			keys, err = psqldb.PlanRollbackWithOptions(
+				ctx, lgr, db, migrations, *target, opts,
+			)
+		} else {
+			keys, err = psqldb.PlanMigrations(ctx, db, migrations, opts)
+		}
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		return nil
+	case "baseline":
+		return psqldb.BaselineMigrations(
+			ctx, lgr, db, migrations, *target, opts,
+		)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %s", flag.Arg(0))
+	}
+}
+
+func printStatus(status []psqldb.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSTATE\tAPPLIED AT\tCHECKSUM")
+	for _, st := range status {
+		applied := "-"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Format(time.RFC3339)
+		}
+		sum := st.Checksum
+		if sum == "" {
+			sum = st.AppliedChecksum
+		}
+		if len(sum) > 12 {
+			sum = sum[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Key, st.State, applied, sum)
+	}
+	w.Flush()
+}
+
+// noopTracer the migrations don't need to be traced
+type noopTracer struct{}
+
+func (*noopTracer) TraceDependency(
+	ctx context.Context,
+	spanId string,
+	dependencyType string,
+	serviceName string,
+	commandName string,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) {
+}
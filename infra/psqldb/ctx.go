@@ -1,28 +1,164 @@
 package psqldb
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/logger"
 	"github.com/BetaLixT/tsqlx"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPingTimeout = 5 * time.Second
+	defaultPingBackoff = time.Second
 )
 
-// NewDatabaseContext creates a new database context
+// ErrSlowQueryLogger slow query logging was configured without a logger
+// factory to log with
+var ErrSlowQueryLogger = errors.New(
+	"slow query logging requires a logger factory",
+)
+
+// NewDatabaseContext creates a new database context, fails with
+// ErrSlowQueryLogger if a SlowQueryThreshold is set since there is no logger
+// to log slow queries with, use NewDatabaseContextWithLogger for that
 func NewDatabaseContext(
 	tracer tsqlx.ITracer,
 	optn *DatabaseOptions,
 ) (*tsqlx.TracedDB, error) {
-	db, err := sqlx.Open("postgres", optn.ConnectionString)
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.Ping()
+	db, err := newDatabase(context.Background(), nil, optn)
 	if err != nil {
 		return nil, err
 	}
-
 	return tsqlx.NewTracedDB(
 		db,
 		tracer,
 		optn.DatabaseServiceName,
 	), nil
 }
+
+// NewDatabaseContextWithLogger creates a new database context that logs
+// queries slower than the SlowQueryThreshold of the options with the trace
+// ids of their context, the returned TracedDB passes the context of its
+// statements down to the driver. lgrf may be nil if no threshold is set
+func NewDatabaseContextWithLogger(
+	tracer tsqlx.ITracer,
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) (*TracedDB, error) {
+	db, err := newDatabase(context.Background(), lgrf, optn)
+	if err != nil {
+		return nil, err
+	}
+	return NewTracedDB(db, tracer, optn.DatabaseServiceName), nil
+}
+
+// NewDatabaseContextWithCleanup creates a new database context like
+// NewDatabaseContextWithLogger along with a cleanup function that closes it,
+// to be called on shutdown
+func NewDatabaseContextWithCleanup(
+	tracer tsqlx.ITracer,
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) (*TracedDB, func(), error) {
+	db, err := NewDatabaseContextWithLogger(tracer, lgrf, optn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() {
+		db.Close()
+	}, nil
+}
+
+// Opens the database, applies the pool options and pings it
+func newDatabase(
+	ctx context.Context,
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) (*sqlx.DB, error) {
+	db, err := openDatabase(lgrf, optn)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(db, optn)
+
+	if err = pingWithRetry(ctx, db, optn); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Opens the database, the driver is wrapped if slow queries are to be
+// logged
+func openDatabase(
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) (*sqlx.DB, error) {
+	if optn.SlowQueryThreshold <= 0 {
+		return sqlx.Open("postgres", optn.ConnectionString)
+	}
+	if lgrf == nil {
+		return nil, ErrSlowQueryLogger
+	}
+
+	connector, err := pq.NewConnector(optn.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	sl := newSlowQueryLog(lgrf, optn)
+	sl.db = sql.OpenDB(&slowQueryConnector{Connector: connector, log: sl})
+	return sqlx.NewDb(sl.db, "postgres"), nil
+}
+
+// Applies the pool options
+func configurePool(db *sqlx.DB, optn *DatabaseOptions) {
+	if optn.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(optn.MaxOpenConns)
+	}
+	if optn.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(optn.MaxIdleConns)
+	}
+	if optn.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(optn.ConnMaxLifetime)
+	}
+	if optn.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(optn.ConnMaxIdleTime)
+	}
+}
+
+// Pings the database, retrying with an exponential backoff
+func pingWithRetry(
+	ctx context.Context,
+	db *sqlx.DB,
+	optn *DatabaseOptions,
+) (err error) {
+	timeout := optn.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	delay := optn.PingBackoff
+	if delay <= 0 {
+		delay = defaultPingBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		pctx, cancel := context.WithTimeout(ctx, timeout)
+		err = db.PingContext(pctx)
+		cancel()
+		if err == nil || attempt >= optn.PingRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
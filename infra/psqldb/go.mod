@@ -1,13 +1,27 @@
-module github.com/BetaLixT/gowebstd/infra/memcache
+module github.com/BetaLixT/gowebstd/infra/psqldb
 
 go 1.19
 
 require (
+	github.com/BetaLixT/gowebstd v0.0.0
+	github.com/BetaLixT/gowebstd/infra/tracelib v0.0.0
 	github.com/BetaLixT/tsqlx v0.2.0
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/lib/pq v1.10.9
 	go.uber.org/zap v1.27.0
 )
 
-require go.uber.org/multierr v1.10.0 // indirect
+require (
+	github.com/Soreing/motel v0.1.2 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel v1.13.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.13.0 // indirect
+	go.opentelemetry.io/otel/trace v1.13.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+)
 
 replace github.com/BetaLixT/gowebstd v0.0.0 => ../..
+
+replace github.com/BetaLixT/gowebstd/infra/tracelib => ../tracelib
@@ -0,0 +1,221 @@
+package psqldb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/BetaLixT/tsqlx"
+	"go.uber.org/zap"
+)
+
+// helperMigrations the timestamp and version helper procedures, versioned and
+// tracked like any other migration set in their own table so they're only
+// installed once per schema and can be torn down completely
+var helperMigrations = []MigrationScript{
+	{
+		Key: "0001_timestamp_procedures",
+		Up: `
+			CREATE OR REPLACE FUNCTION trigger_set_datetimecreated()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.dateTimeCreated = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE OR REPLACE FUNCTION trigger_set_date_time_created()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.date_time_created = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE OR REPLACE FUNCTION trigger_set_date_time_updated()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.date_time_updated = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE OR REPLACE FUNCTION trigger_set_event_time()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.event_time = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE OR REPLACE FUNCTION version_update()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.version = OLD.version + 1;
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;`,
+		Down: `
+			DROP FUNCTION IF EXISTS version_update();
+			DROP FUNCTION IF EXISTS trigger_set_event_time();
+			DROP FUNCTION IF EXISTS trigger_set_date_time_updated();
+			DROP FUNCTION IF EXISTS trigger_set_date_time_created();
+			DROP FUNCTION IF EXISTS trigger_set_datetimecreated();`,
+	},
+	{
+		Key: "0002_datetimeupdated_procedure",
+		Up: `
+			CREATE OR REPLACE FUNCTION trigger_set_datetimeupdated()
+			RETURNS TRIGGER AS $$
+			BEGIN
+				NEW.dateTimeUpdated = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;`,
+		Down: `
+			DROP FUNCTION IF EXISTS trigger_set_datetimeupdated();`,
+	},
+}
+
+// Options for the helper migration set derived from the options of the
+// application migrations, the lock is expected to be held already
+func (opts *MigrationOptions) helperOptions() *MigrationOptions {
+	hopts := *opts
+	hopts.MigrationsTable = opts.tableName() + "_helpers"
+	hopts.DisableHelpers = true
+	hopts.DisableLock = true
+	hopts.TransactionPerMigration = false
+	return &hopts
+}
+
+// Applies the pending helper migrations
+func installHelpers(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	opts *MigrationOptions,
+) error {
+	return runMigrations(
+		ctx,
+		lgr.With(zap.String("set", "helpers")),
+		db,
+		helperMigrations,
+		opts.helperOptions(),
+	)
+}
+
+// RemoveHelpers tears the helper procedures down and drops their history
+// table, fails if any trigger still depends on them
+func RemoveHelpers(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	opts *MigrationOptions,
+) error {
+	hopts := opts.helperOptions()
+	return opts.withLock(ctx, lgr, db, func() (err error) {
+		err = rollbackMigrations(ctx, lgr, db, helperMigrations, "", hopts)
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, hopts.query(migrationTable.Down))
+		return err
+	})
+}
+
+// helperTrigger the procedure maintaining a column and the event it's
+// triggered on
+type helperTrigger struct {
+	procedure string
+	event     string
+}
+
+var createdTriggers = map[string]helperTrigger{
+	"datetimecreated":   {"trigger_set_datetimecreated", "INSERT"},
+	"date_time_created": {"trigger_set_date_time_created", "INSERT"},
+	"event_time":        {"trigger_set_event_time", "INSERT"},
+}
+
+var updatedTriggers = map[string]helperTrigger{
+	"datetimeupdated":   {"trigger_set_datetimeupdated", "UPDATE"},
+	"date_time_updated": {"trigger_set_date_time_updated", "UPDATE"},
+}
+
+// CreatedTrigger returns the statements creating and dropping a trigger that
+// sets the creation timestamp column (datetimecreated, date_time_created or
+// event_time) of the table on insert
+func CreatedTrigger(table string, column string) (up, down string, err error) {
+	return buildTrigger(createdTriggers, table, column)
+}
+
+// UpdatedTrigger returns the statements creating and dropping a trigger that
+// sets the update timestamp column (datetimeupdated or date_time_updated) of
+// the table on update
+func UpdatedTrigger(table string, column string) (up, down string, err error) {
+	return buildTrigger(updatedTriggers, table, column)
+}
+
+// VersionTrigger returns the statements creating and dropping a trigger that
+// increments the version column of the table on update
+func VersionTrigger(table string) (up, down string) {
+	up, down, _ = buildTrigger(
+		map[string]helperTrigger{"version": {"version_update", "UPDATE"}},
+		table,
+		"version",
+	)
+	return
+}
+
+func buildTrigger(
+	triggers map[string]helperTrigger,
+	table string,
+	column string,
+) (up, down string, err error) {
+	trg, ok := triggers[strings.ToLower(column)]
+	if !ok {
+		return "", "", fmt.Errorf("no helper procedure for column %s", column)
+	}
+
+	// the trigger is named after the unqualified table
+	name := quoteIdentifier(fmt.Sprintf(
+		"set_%s_%s",
+		unqualifiedName(table),
+		strings.ToLower(column),
+	))
+
+	up = fmt.Sprintf(`
+		CREATE TRIGGER %s
+		BEFORE %s ON %s
+		FOR EACH ROW
+		EXECUTE PROCEDURE %s();`,
+		name, trg.event, table, trg.procedure,
+	)
+	down = fmt.Sprintf(`
+		DROP TRIGGER IF EXISTS %s ON %s;`,
+		name, table,
+	)
+	return up, down, nil
+}
+
+// Strips the schema and quotes from a possibly qualified and quoted table
+// name, dots inside of quotes are part of the name and unquoted names are
+// folded to lower case like postgres does
+func unqualifiedName(table string) string {
+	quoted := false
+	start := 0
+	for i := 0; i < len(table); i++ {
+		switch table[i] {
+		case '"':
+			quoted = !quoted
+		case '.':
+			if !quoted {
+				start = i + 1
+			}
+		}
+	}
+	name := table[start:]
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return strings.ToLower(name)
+}
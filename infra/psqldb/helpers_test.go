@@ -0,0 +1,94 @@
+package psqldb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func() (string, string, error)
+		trigger string
+		table   string
+		proc    string
+		err     bool
+	}{
+		{
+			name: "created",
+			build: func() (string, string, error) {
+				return CreatedTrigger("users", "datetimecreated")
+			},
+			trigger: `"set_users_datetimecreated"`,
+			table:   "users",
+			proc:    "trigger_set_datetimecreated",
+		},
+		{
+			name: "qualified",
+			build: func() (string, string, error) {
+				return UpdatedTrigger("tenant.Users", "DATE_TIME_UPDATED")
+			},
+			trigger: `"set_users_date_time_updated"`,
+			table:   "tenant.Users",
+			proc:    "trigger_set_date_time_updated",
+		},
+		{
+			name: "quoted with spaces",
+			build: func() (string, string, error) {
+				return CreatedTrigger(`"Order Items"`, "event_time")
+			},
+			trigger: `"set_Order Items_event_time"`,
+			table:   `"Order Items"`,
+			proc:    "trigger_set_event_time",
+		},
+		{
+			name: "quoted with dot and quote",
+			build: func() (string, string, error) {
+				return CreatedTrigger(`"shop"."a.b""c"`, "date_time_created")
+			},
+			trigger: `"set_a.b""c_date_time_created"`,
+			table:   `"shop"."a.b""c"`,
+			proc:    "trigger_set_date_time_created",
+		},
+		{
+			name: "version",
+			build: func() (string, string, error) {
+				up, down := VersionTrigger("users")
+				return up, down, nil
+			},
+			trigger: `"set_users_version"`,
+			table:   "users",
+			proc:    "version_update",
+		},
+		{
+			name: "unknown column",
+			build: func() (string, string, error) {
+				return UpdatedTrigger("users", "modified_at")
+			},
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down, err := tt.build()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(up, "CREATE TRIGGER "+tt.trigger+"\n") ||
+				!strings.Contains(up, " ON "+tt.table+"\n") ||
+				!strings.Contains(up, "EXECUTE PROCEDURE "+tt.proc+"();") {
+				t.Errorf("unexpected up statement %s", up)
+			}
+			want := "DROP TRIGGER IF EXISTS " + tt.trigger + " ON " + tt.table + ";"
+			if strings.TrimSpace(down) != want {
+				t.Errorf("expected %s, got %s", want, strings.TrimSpace(down))
+			}
+		})
+	}
+}
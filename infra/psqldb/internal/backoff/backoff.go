@@ -0,0 +1,19 @@
+// Package backoff computes the exponential retry delays of the psqldb
+// background workers
+package backoff
+
+import "time"
+
+// Delay after the given number of failed attempts, counting the attempt that
+// just failed, the first failure waits initial and every further failure
+// doubles it up to max
+func Delay(initial time.Duration, max time.Duration, failures int) time.Duration {
+	delay := initial
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
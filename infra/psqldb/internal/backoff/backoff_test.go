@@ -0,0 +1,31 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  time.Duration
+		max      time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", initial: time.Second, max: time.Minute, failures: 1, want: time.Second},
+		{name: "no failures", initial: time.Second, max: time.Minute, failures: 0, want: time.Second},
+		{name: "second failure", initial: time.Second, max: time.Minute, failures: 2, want: 2 * time.Second},
+		{name: "fifth failure", initial: time.Second, max: time.Minute, failures: 5, want: 16 * time.Second},
+		{name: "capped", initial: time.Second, max: time.Minute, failures: 10, want: time.Minute},
+		{name: "many failures", initial: time.Second, max: time.Hour, failures: 1000, want: time.Hour},
+		{name: "initial above max", initial: time.Hour, max: time.Minute, failures: 1, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Delay(tt.initial, tt.max, tt.failures); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
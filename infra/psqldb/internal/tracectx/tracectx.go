@@ -0,0 +1,81 @@
+// Package tracectx carries w3c trace context through the background workers
+// of the psqldb subpackages, the trace is stored as a traceparent with the
+// work and restored into an IContext when the work runs
+package tracectx
+
+import (
+	"context"
+
+	"github.com/BetaLixT/gowebstd/externals/cntxt"
+	"github.com/BetaLixT/gowebstd/infra/tracelib"
+)
+
+// Traceparent of the current request in the context, empty if the context
+// carries no trace information
+func Traceparent(ctx context.Context) string {
+	ictx, ok := ctx.(cntxt.IContext)
+	if !ok {
+		return ""
+	}
+	_, tid, _, rid, flg := ictx.GetTraceInfo()
+	h, err := tracelib.ParseTraceHandle(tid, rid, flg)
+	if err != nil {
+		return ""
+	}
+	return h.TraceParent()
+}
+
+// Context root context of background work, it's a span in the trace of the
+// stored traceparent or in a new trace
+type Context struct {
+	context.Context
+	span   tracelib.TraceHandle
+	parent string
+}
+
+var _ cntxt.IContext = (*Context)(nil)
+
+// New creates a context for a new span that's a child of the traceparent, a
+// new trace is started if the traceparent is empty or invalid
+func New(parent context.Context, traceparent string) *Context {
+	ctx := &Context{Context: parent}
+	if h, err := tracelib.ParseTraceParent(traceparent); err == nil {
+		if c, err := h.Child(); err == nil {
+			ctx.span = c
+			ctx.parent = h.SpanIdString()
+			return ctx
+		}
+	}
+	ctx.span, _ = tracelib.NewTraceHandle()
+	return ctx
+}
+
+// Span handle of the span of the context
+func (c *Context) Span() tracelib.TraceHandle {
+	return c.span
+}
+
+// ParentId span id of the parent span, empty for a new trace
+func (c *Context) ParentId() string {
+	return c.parent
+}
+
+func (c *Context) GetTraceInfo() (ver, tid, pid, rid, flg string) {
+	return "00",
+		c.span.TraceIdString(),
+		c.parent,
+		c.span.SpanIdString(),
+		c.span.FlagsString()
+}
+
+func (c *Context) GenerateSpanID() (string, error) {
+	h, err := c.span.Child()
+	if err != nil {
+		return "", err
+	}
+	return h.SpanIdString(), nil
+}
+
+func (c *Context) WithValue(key any, val any) {
+	c.Context = context.WithValue(c.Context, key, val)
+}
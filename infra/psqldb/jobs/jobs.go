@@ -0,0 +1,244 @@
+// Package jobs implements a durable background job queue on top of psqldb,
+// jobs are claimed with FOR UPDATE SKIP LOCKED so any number of worker pools
+// can share a queue
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+)
+
+var (
+	ErrDuplicateJob = errors.New("job with unique key already queued")
+	ErrJobNotFound  = errors.New("job not found")
+)
+
+// Job states
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateDead      = "dead"
+)
+
+// Job a unit of background work
+type Job struct {
+	Id       int64  `db:"id"`
+	Queue    string `db:"queue"`
+	Kind     string `db:"kind"`
+	Payload  []byte `db:"payload"`
+	Priority int    `db:"priority"`
+	// UniqueKey prevents enqueueing the job while another job of the queue
+	// with the same key is pending or running
+	UniqueKey   sql.NullString `db:"unique_key"`
+	RunAt       time.Time      `db:"run_at"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	Traceparent string         `db:"traceparent"`
+}
+
+// IQueryer a database or transaction jobs can be enqueued with, both
+// *tsqlx.TracedDB and *tsqlx.TracedTx satisfy it
+type IQueryer interface {
+	Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Migration creates the jobs table with the indexes used to claim jobs,
+// rescue stale ones and enforce unique keys. The service picks the key, pass
+// it to psqldb.LoadMigrations as a func with a versioned key such as
+// "0006_create_jobs" to place the table between its own migrations
+func Migration(opts *Options, key string) psqldb.MigrationScript {
+	o := opts.withDefaults()
+	return psqldb.MigrationScript{
+		Key: key,
+		Up: fmt.Sprintf(`
+			CREATE TABLE %[1]s (
+				id BIGSERIAL PRIMARY KEY,
+				queue text NOT NULL,
+				kind text NOT NULL,
+				payload bytea NOT NULL,
+				priority int NOT NULL DEFAULT 0,
+				unique_key text NULL,
+				state text NOT NULL DEFAULT 'pending',
+				attempts int NOT NULL DEFAULT 0,
+				max_attempts int NOT NULL,
+				run_at timestamp with time zone NOT NULL DEFAULT NOW(),
+				heartbeat_at timestamp with time zone NULL,
+				locked_by text NULL,
+				last_error text NULL,
+				traceparent text NOT NULL DEFAULT '',
+				created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+				finished_at timestamp with time zone NULL
+			);
+
+			CREATE INDEX %[1]s_claim_idx ON %[1]s (queue, priority DESC, run_at)
+			WHERE state = 'pending';
+
+			CREATE INDEX %[1]s_running_idx ON %[1]s (heartbeat_at)
+			WHERE state = 'running';
+
+			CREATE UNIQUE INDEX %[1]s_unique_key_idx ON %[1]s (queue, unique_key)
+			WHERE unique_key IS NOT NULL AND state IN ('pending', 'running');`,
+			o.Table,
+		),
+		Down: fmt.Sprintf(`
+			DROP TABLE %s;`,
+			o.Table,
+		),
+	}
+}
+
+// Enqueue adds the job to the queue of the options unless the job sets its
+// own, a zero RunAt runs the job immediately and a zero MaxAttempts uses the
+// default of the options. Enqueueing with a transaction makes the job
+// available only once the transaction commits. The trace context of ctx is
+// stored with the job so it runs as part of the same trace
+func Enqueue(
+	ctx context.Context,
+	q IQueryer,
+	opts *Options,
+	job Job,
+) (int64, error) {
+	o := opts.withDefaults()
+	if job.Queue == "" {
+		job.Queue = o.Queue
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = o.MaxAttempts
+	}
+	runAt := sql.NullTime{Time: job.RunAt, Valid: !job.RunAt.IsZero()}
+
+	var id int64
+	err := q.Get(
+		ctx,
+		&id,
+		fmt.Sprintf(insertJob, o.Table),
+		job.Queue,
+		job.Kind,
+		job.Payload,
+		job.Priority,
+		job.UniqueKey,
+		runAt,
+		job.MaxAttempts,
+		tracectx.Traceparent(ctx),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrDuplicateJob
+	}
+	return id, err
+}
+
+// Requeue moves a dead job back to pending with its attempts reset
+func Requeue(
+	ctx context.Context,
+	q IQueryer,
+	opts *Options,
+	id int64,
+) error {
+	o := opts.withDefaults()
+	res, err := q.Exec(ctx, fmt.Sprintf(requeueJob, o.Table), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Query templates taking the jobs table
+const (
+	insertJob = `
+		INSERT INTO %s (
+			queue, kind, payload, priority, unique_key, run_at, max_attempts,
+			traceparent
+		)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, NOW()), $7, $8)
+		ON CONFLICT (queue, unique_key)
+			WHERE unique_key IS NOT NULL AND state IN ('pending', 'running')
+			DO NOTHING
+		RETURNING id`
+	claimJobs = `
+		UPDATE %[1]s
+		SET state = 'running',
+			attempts = attempts + 1,
+			heartbeat_at = NOW(),
+			locked_by = $3
+		WHERE id IN (
+			SELECT id FROM %[1]s
+			WHERE queue = $1 AND state = 'pending' AND run_at <= NOW()
+			ORDER BY priority DESC, run_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, queue, kind, payload, priority, unique_key, run_at,
+			attempts, max_attempts, traceparent`
+	heartbeatJobs = `
+		UPDATE %s SET heartbeat_at = NOW()
+		WHERE id = ANY($1) AND state = 'running' AND locked_by = $2`
+	// results are only recorded if the job is still held by the same claim,
+	// a job rescued and claimed again (even by the same worker) has a
+	// different attempt
+	completeJob = `
+		UPDATE %s
+		SET state = 'succeeded',
+			finished_at = NOW(),
+			heartbeat_at = NULL,
+			locked_by = NULL
+		WHERE id = $1
+			AND state = 'running'
+			AND locked_by = $2
+			AND attempts = $3`
+	retryJob = `
+		UPDATE %s
+		SET state = 'pending',
+			last_error = $4,
+			run_at = NOW() + $5 * interval '1 millisecond',
+			heartbeat_at = NULL,
+			locked_by = NULL
+		WHERE id = $1
+			AND state = 'running'
+			AND locked_by = $2
+			AND attempts = $3`
+	killJob = `
+		UPDATE %s
+		SET state = 'dead',
+			last_error = $4,
+			finished_at = NOW(),
+			heartbeat_at = NULL,
+			locked_by = NULL
+		WHERE id = $1
+			AND state = 'running'
+			AND locked_by = $2
+			AND attempts = $3`
+	rescueJobs = `
+		UPDATE %s
+		SET state = CASE WHEN attempts >= max_attempts
+				THEN 'dead' ELSE 'pending' END,
+			last_error = 'job abandoned by ' || COALESCE(locked_by, 'unknown'),
+			finished_at = CASE WHEN attempts >= max_attempts
+				THEN NOW() ELSE NULL END,
+			heartbeat_at = NULL,
+			locked_by = NULL
+		WHERE queue = $1
+			AND state = 'running'
+			AND heartbeat_at < NOW() - $2 * interval '1 millisecond'`
+	requeueJob = `
+		UPDATE %s
+		SET state = 'pending',
+			attempts = 0,
+			run_at = NOW(),
+			finished_at = NULL
+		WHERE id = $1 AND state = 'dead'`
+)
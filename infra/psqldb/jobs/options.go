@@ -0,0 +1,69 @@
+package jobs
+
+import "time"
+
+// Options options for the jobs table and worker pool
+type Options struct {
+	// Table name of the jobs table, defaults to "jobs"
+	Table string
+	// Queue the queue jobs are enqueued to and claimed from, defaults to
+	// "default"
+	Queue string
+	// Concurrency maximum jobs run at the same time, defaults to 10
+	Concurrency int
+	// PollInterval delay between polls when no jobs are available, defaults
+	// to 1 second
+	PollInterval time.Duration
+	// HeartbeatInterval interval at which running jobs are marked alive,
+	// defaults to 10 seconds
+	HeartbeatInterval time.Duration
+	// StaleAfter time without a heartbeat after which a running job is
+	// considered abandoned and rescheduled, defaults to 1 minute
+	StaleAfter time.Duration
+	// MaxAttempts default attempts of a job before it's dead lettered,
+	// defaults to 25
+	MaxAttempts int
+	// RetryBackoff initial delay before a failed job is retried, doubled on
+	// every attempt, defaults to 1 second
+	RetryBackoff time.Duration
+	// MaxBackoff upper bound of the retry delay, defaults to 1 hour
+	MaxBackoff time.Duration
+	// WorkerId identifies the pool in the locked_by column, defaults to the
+	// hostname
+	WorkerId string
+}
+
+func (opts *Options) withDefaults() Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Table == "" {
+		o.Table = "jobs"
+	}
+	if o.Queue == "" {
+		o.Queue = "default"
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 10
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.HeartbeatInterval <= 0 {
+		o.HeartbeatInterval = 10 * time.Second
+	}
+	if o.StaleAfter <= 0 {
+		o.StaleAfter = time.Minute
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 25
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	return o
+}
@@ -0,0 +1,413 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/logger"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/backoff"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"github.com/BetaLixT/tsqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoHandler   = errors.New("no handler registered for job kind")
+	ErrPoolStarted = errors.New("worker pool already started")
+)
+
+// HandlerFunc runs a job, a returned error schedules a retry or dead letters
+// the job once it's out of attempts. The context is cancelled if the pool is
+// forced to shut down
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// ITracer traces each job run as a request
+type ITracer interface {
+	TraceRequestWithIds(
+		traceId string,
+		parentId string,
+		requestId string,
+		method string,
+		path string,
+		query string,
+		statusCode int,
+		bodySize int,
+		ip string,
+		userAgent string,
+		startTimestamp time.Time,
+		eventTimestamp time.Time,
+		fields map[string]string,
+	)
+}
+
+// IMetrics records job runs, promex.JobMetrics implements it
+type IMetrics interface {
+	JobStarted(queue string, kind string)
+	JobFinished(queue string, kind string, status string, duration time.Duration)
+}
+
+// Outcomes of a job run as reported to the metrics
+const (
+	StatusSucceeded = "succeeded"
+	StatusRetried   = "retried"
+	StatusDead      = "dead"
+)
+
+// Pool runs jobs of a queue with a fixed number of concurrent workers
+type Pool struct {
+	db       *tsqlx.TracedDB
+	tracer   ITracer
+	metrics  IMetrics
+	lgr      *zap.Logger
+	opts     Options
+	handlers map[string]HandlerFunc
+
+	mtx     *sync.Mutex
+	running map[int64]struct{}
+	started bool
+
+	slots  chan struct{}
+	stop   chan struct{}
+	once   *sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  *sync.WaitGroup
+	jobs   *sync.WaitGroup
+}
+
+// NewPool constructs a worker pool, handlers have to be registered before
+// Start is called. tracer and metrics are optional
+func NewPool(
+	db *tsqlx.TracedDB,
+	tracer ITracer,
+	metrics IMetrics,
+	lgrf logger.IFactory,
+	opts *Options,
+) *Pool {
+	o := opts.withDefaults()
+	if o.WorkerId == "" {
+		host, _ := os.Hostname()
+		o.WorkerId = fmt.Sprintf("%s/%d", host, os.Getpid())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		db:       db,
+		tracer:   tracer,
+		metrics:  metrics,
+		lgr:      lgrf.Create(context.Background()),
+		opts:     o,
+		handlers: map[string]HandlerFunc{},
+		mtx:      &sync.Mutex{},
+		running:  map[int64]struct{}{},
+		slots:    make(chan struct{}, o.Concurrency),
+		stop:     make(chan struct{}),
+		once:     &sync.Once{},
+		ctx:      ctx,
+		cancel:   cancel,
+		loops:    &sync.WaitGroup{},
+		jobs:     &sync.WaitGroup{},
+	}
+}
+
+// Handle registers the handler of a job kind
+func (p *Pool) Handle(kind string, fn HandlerFunc) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.handlers[kind] = fn
+}
+
+// Start starts claiming and running jobs in the background
+func (p *Pool) Start() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.started {
+		return ErrPoolStarted
+	}
+	p.started = true
+
+	p.loops.Add(2)
+	go p.poll()
+	go p.heartbeat()
+	return nil
+}
+
+// Shutdown stops claiming jobs and waits for running jobs to finish, if ctx
+// is done first the jobs are cancelled and waited for again
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	p.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		p.jobs.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+	return err
+}
+
+// Claims jobs into free worker slots
+func (p *Pool) poll() {
+	defer p.loops.Done()
+	for {
+		n, err := p.claim()
+		if err != nil {
+			p.lgr.Error("failed claiming jobs", zap.Error(err))
+		}
+
+		// keep claiming while jobs are available and slots are free
+		wait := p.opts.PollInterval
+		if err == nil && n > 0 {
+			wait = 0
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(wait):
+		}
+
+		// wait for a slot to free up before claiming again
+		select {
+		case <-p.stop:
+			return
+		case p.slots <- struct{}{}:
+			<-p.slots
+		}
+	}
+}
+
+func (p *Pool) claim() (int, error) {
+	free := cap(p.slots) - len(p.slots)
+	if free <= 0 {
+		return 0, nil
+	}
+
+	claimed := []Job{}
+	err := p.db.Select(
+		context.Background(),
+		&claimed,
+		fmt.Sprintf(claimJobs, p.opts.Table),
+		p.opts.Queue,
+		free,
+		p.opts.WorkerId,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range claimed {
+		job := claimed[i]
+		p.slots <- struct{}{}
+		p.mtx.Lock()
+		p.running[job.Id] = struct{}{}
+		p.mtx.Unlock()
+
+		p.jobs.Add(1)
+		go func() {
+			defer func() {
+				p.mtx.Lock()
+				delete(p.running, job.Id)
+				p.mtx.Unlock()
+				<-p.slots
+				p.jobs.Done()
+			}()
+			p.run(&job)
+		}()
+	}
+	return len(claimed), nil
+}
+
+// Keeps running jobs alive and reschedules jobs abandoned by crashed workers
+func (p *Pool) heartbeat() {
+	defer p.loops.Done()
+	ticker := time.NewTicker(p.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mtx.Lock()
+		ids := make([]int64, 0, len(p.running))
+		for id := range p.running {
+			ids = append(ids, id)
+		}
+		p.mtx.Unlock()
+
+		ctx := context.Background()
+		if len(ids) > 0 {
+			_, err := p.db.Exec(
+				ctx,
+				fmt.Sprintf(heartbeatJobs, p.opts.Table),
+				pq.Array(ids),
+				p.opts.WorkerId,
+			)
+			if err != nil {
+				p.lgr.Error("failed sending job heartbeat", zap.Error(err))
+			}
+		}
+
+		_, err := p.db.Exec(
+			ctx,
+			fmt.Sprintf(rescueJobs, p.opts.Table),
+			p.opts.Queue,
+			p.opts.StaleAfter.Milliseconds(),
+		)
+		if err != nil {
+			p.lgr.Error("failed rescuing stale jobs", zap.Error(err))
+		}
+	}
+}
+
+// Runs the job as a request span and records its outcome
+func (p *Pool) run(job *Job) {
+	// the job runs as a request in the trace it was enqueued in
+	ctx := tracectx.New(p.ctx, job.Traceparent)
+	start := time.Now()
+	if p.metrics != nil {
+		p.metrics.JobStarted(job.Queue, job.Kind)
+	}
+
+	err := p.handle(ctx, job)
+	end := time.Now()
+
+	status, code := StatusSucceeded, 200
+	if err != nil {
+		status, code = StatusRetried, 500
+		if job.Attempts >= job.MaxAttempts {
+			status = StatusDead
+		}
+		p.lgr.Warn(
+			"job failed",
+			zap.Int64("id", job.Id),
+			zap.String("kind", job.Kind),
+			zap.Int("attempts", job.Attempts),
+			zap.String("status", status),
+			zap.Error(err),
+		)
+	}
+
+	recorded, rerr := p.record(job, status, err)
+	if rerr != nil {
+		p.lgr.Error(
+			"failed recording job result",
+			zap.Int64("id", job.Id),
+			zap.Error(rerr),
+		)
+	} else if !recorded {
+		p.lgr.Warn(
+			"job result discarded, the job was rescued while running",
+			zap.Int64("id", job.Id),
+			zap.String("kind", job.Kind),
+			zap.Int("attempts", job.Attempts),
+			zap.String("status", status),
+		)
+	}
+	if p.metrics != nil {
+		p.metrics.JobFinished(job.Queue, job.Kind, status, end.Sub(start))
+	}
+	if p.tracer != nil {
+		fields := map[string]string{
+			"jobId":    strconv.FormatInt(job.Id, 10),
+			"queue":    job.Queue,
+			"attempts": strconv.Itoa(job.Attempts),
+			"status":   status,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		span := ctx.Span()
+		p.tracer.TraceRequestWithIds(
+			span.TraceIdString(),
+			ctx.ParentId(),
+			span.SpanIdString(),
+			"JOB", job.Kind, "",
+			code, len(job.Payload), "", p.opts.WorkerId,
+			start, end,
+			fields,
+		)
+	}
+}
+
+// Calls the handler of the job, panics are reported as errors
+func (p *Pool) handle(ctx context.Context, job *Job) (err error) {
+	p.mtx.Lock()
+	fn, ok := p.handlers[job.Kind]
+	p.mtx.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx, job)
+}
+
+// Records the result of the run, returns false if the job is no longer held
+// by this run because it was rescued after missing its heartbeats
+func (p *Pool) record(job *Job, status string, err error) (bool, error) {
+	ctx := context.Background()
+	var res sql.Result
+	switch status {
+	case StatusSucceeded:
+		res, err = p.db.Exec(
+			ctx,
+			fmt.Sprintf(completeJob, p.opts.Table),
+			job.Id,
+			p.opts.WorkerId,
+			job.Attempts,
+		)
+	case StatusRetried:
+		res, err = p.db.Exec(
+			ctx,
+			fmt.Sprintf(retryJob, p.opts.Table),
+			job.Id,
+			p.opts.WorkerId,
+			job.Attempts,
+			err.Error(),
+			backoff.Delay(
+				p.opts.RetryBackoff,
+				p.opts.MaxBackoff,
+				job.Attempts,
+			).Milliseconds(),
+		)
+	case StatusDead:
+		res, err = p.db.Exec(
+			ctx,
+			fmt.Sprintf(killJob, p.opts.Table),
+			job.Id,
+			p.opts.WorkerId,
+			job.Attempts,
+			err.Error(),
+		)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,155 @@
+package psqldb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMigrationName = errors.New("invalid migration name")
+	ErrDuplicateMigration   = errors.New("duplicate migration version")
+	ErrMissingUp            = errors.New("migration has no up script")
+)
+
+// NoTransactionDirective marks a migration file to be run outside of a
+// transaction when it's in the leading comments of the up or down script, the
+// statements of the script are run one at a time
+const NoTransactionDirective = "-- psqldb:no-transaction"
+
+var (
+	migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	migrationKeyPattern  = regexp.MustCompile(`^(\d+)_(\w+)$`)
+)
+
+type versionedMigration struct {
+	version int
+	script  MigrationScript
+	hasUp   bool
+}
+
+// LoadMigrations loads the migrations from a directory of a file system (such
+// as an embed.FS), files are named <version>_<name>.up.sql and
+// <version>_<name>.down.sql and the key of the migration is <version>_<name>.
+// Migrations implemented as go functions can be passed in as funcs, their
+// keys must follow the same naming, they are ordered together with the file
+// migrations by version. Versions must be unique and every down script must
+// have an up script. A migration whose up or down script starts with the
+// NoTransactionDirective comment is flagged NoTransaction
+func LoadMigrations(
+	fsys fs.FS,
+	dir string,
+	funcs ...MigrationScript,
+) ([]MigrationScript, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*versionedMigration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, e.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, e.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		key := match[1] + "_" + match[2]
+		migr, ok := byKey[key]
+		if !ok {
+			migr = &versionedMigration{
+				version: version,
+				script:  MigrationScript{Key: key},
+			}
+			byKey[key] = migr
+		}
+		if hasNoTransactionDirective(string(content)) {
+			migr.script.NoTransaction = true
+		}
+		if match[3] == "up" {
+			migr.script.Up = string(content)
+			migr.hasUp = true
+		} else {
+			migr.script.Down = string(content)
+		}
+	}
+
+	for _, f := range funcs {
+		match := migrationKeyPattern.FindStringSubmatch(f.Key)
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, f.Key)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, f.Key)
+		}
+		if _, ok := byKey[f.Key]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateMigration, f.Key)
+		}
+		byKey[f.Key] = &versionedMigration{
+			version: version,
+			script:  f,
+			hasUp:   f.Up != "" || f.UpFunc != nil,
+		}
+	}
+
+	versioned := make([]*versionedMigration, 0, len(byKey))
+	for _, migr := range byKey {
+		if !migr.hasUp {
+			return nil, fmt.Errorf("%w: %s", ErrMissingUp, migr.script.Key)
+		}
+		versioned = append(versioned, migr)
+	}
+	sort.Slice(versioned, func(i, j int) bool {
+		return versioned[i].version < versioned[j].version
+	})
+
+	migrations := make([]MigrationScript, len(versioned))
+	for i, migr := range versioned {
+		if i > 0 && versioned[i-1].version == migr.version {
+			return nil, fmt.Errorf(
+				"%w: %s and %s",
+				ErrDuplicateMigration,
+				versioned[i-1].script.Key,
+				migr.script.Key,
+			)
+		}
+		migrations[i] = migr.script
+	}
+	return migrations, nil
+}
+
+// Checks the leading comment lines of the script for the
+// NoTransactionDirective
+func hasNoTransactionDirective(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == NoTransactionDirective:
+			return true
+		case strings.HasPrefix(line, "--"):
+			continue
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package psqldb
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	backfill := func(ctx context.Context, tx *sqlx.Tx) error {
+		return nil
+	}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		funcs []MigrationScript
+		keys  []string
+		downs []string
+		err   error
+	}{
+		{
+			name: "pairs up and down",
+			files: fstest.MapFS{
+				"migrations/0001_users.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+				"migrations/0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+				"migrations/0002_orders.up.sql":  {Data: []byte("CREATE TABLE orders ();")},
+			},
+			keys:  []string{"0001_users", "0002_orders"},
+			downs: []string{"DROP TABLE users;", ""},
+		},
+		{
+			name: "orders numerically",
+			files: fstest.MapFS{
+				"migrations/10_late.up.sql": {Data: []byte("SELECT 10;")},
+				"migrations/2_early.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			keys:  []string{"2_early", "10_late"},
+			downs: []string{"", ""},
+		},
+		{
+			name: "ignores directories and other files",
+			files: fstest.MapFS{
+				"migrations/0001_users.up.sql":    {Data: []byte("SELECT 1;")},
+				"migrations/README.md":            {Data: []byte("docs")},
+				"migrations/nested/0002_x.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			keys:  []string{"0001_users"},
+			downs: []string{""},
+		},
+		{
+			name: "merges funcs by version",
+			files: fstest.MapFS{
+				"migrations/0001_users.up.sql":  {Data: []byte("SELECT 1;")},
+				"migrations/0003_orders.up.sql": {Data: []byte("SELECT 3;")},
+			},
+			funcs: []MigrationScript{{Key: "0002_backfill", UpFunc: backfill}},
+			keys:  []string{"0001_users", "0002_backfill", "0003_orders"},
+			downs: []string{"", "", ""},
+		},
+		{
+			name: "invalid file name",
+			files: fstest.MapFS{
+				"migrations/users.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			err: ErrInvalidMigrationName,
+		},
+		{
+			name: "invalid direction",
+			files: fstest.MapFS{
+				"migrations/0001_users.sideways.sql": {Data: []byte("SELECT 1;")},
+			},
+			err: ErrInvalidMigrationName,
+		},
+		{
+			name:  "invalid func key",
+			files: fstest.MapFS{"migrations": {Mode: fs.ModeDir}},
+			funcs: []MigrationScript{{Key: "backfill", UpFunc: backfill}},
+			err:   ErrInvalidMigrationName,
+		},
+		{
+			name: "down without up",
+			files: fstest.MapFS{
+				"migrations/0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+			},
+			err: ErrMissingUp,
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"migrations/0001_users.up.sql": {Data: []byte("SELECT 1;")},
+				"migrations/1_orders.up.sql":   {Data: []byte("SELECT 1;")},
+			},
+			err: ErrDuplicateMigration,
+		},
+		{
+			name: "func duplicates file",
+			files: fstest.MapFS{
+				"migrations/0001_users.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			funcs: []MigrationScript{{Key: "0001_users", UpFunc: backfill}},
+			err:   ErrDuplicateMigration,
+		},
+		{
+			name:  "func without up",
+			files: fstest.MapFS{"migrations": {Mode: fs.ModeDir}},
+			funcs: []MigrationScript{{Key: "0001_users", Down: "SELECT 1;"}},
+			err:   ErrMissingUp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.files, "migrations", tt.funcs...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if len(migrations) != len(tt.keys) {
+				t.Fatalf("expected %d migrations, got %d", len(tt.keys), len(migrations))
+			}
+			for i := range migrations {
+				if migrations[i].Key != tt.keys[i] {
+					t.Errorf("expected key %s at %d, got %s", tt.keys[i], i, migrations[i].Key)
+				}
+				if migrations[i].Down != tt.downs[i] {
+					t.Errorf("expected down %q at %d, got %q", tt.downs[i], i, migrations[i].Down)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsMissingDir(t *testing.T) {
+	_, err := LoadMigrations(fstest.MapFS{}, "migrations")
+	if err == nil {
+		t.Fatal("expected missing directory to fail")
+	}
+}
+
+func TestLoadMigrationsNoTransaction(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0001_users.up.sql": {Data: []byte("CREATE TABLE users ();")},
+		"migrations/0002_users_idx.up.sql": {Data: []byte(
+			NoTransactionDirective + "\nCREATE INDEX CONCURRENTLY users_idx ON users (id);",
+		)},
+		"migrations/0002_users_idx.down.sql": {Data: []byte(
+			"DROP INDEX CONCURRENTLY users_idx;",
+		)},
+		"migrations/0003_orders_idx.up.sql": {Data: []byte(
+			"CREATE INDEX CONCURRENTLY orders_idx ON orders (id);",
+		)},
+		"migrations/0003_orders_idx.down.sql": {Data: []byte(
+			NoTransactionDirective + "\nDROP INDEX CONCURRENTLY orders_idx;",
+		)},
+	}
+
+	migrations, err := LoadMigrations(files, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{false, true, true}
+	for i, migr := range migrations {
+		if migr.NoTransaction != expected[i] {
+			t.Errorf(
+				"expected %s NoTransaction to be %v",
+				migr.Key,
+				expected[i],
+			)
+		}
+	}
+}
+
+func TestHasNoTransactionDirective(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   bool
+	}{
+		{name: "empty", script: "", want: false},
+		{name: "first line", script: NoTransactionDirective + "\nSELECT 1;", want: true},
+		{
+			name:   "after comments and blank lines",
+			script: "\n-- adds the index\n\n  " + NoTransactionDirective + "  \nSELECT 1;",
+			want:   true,
+		},
+		{
+			name:   "after a statement",
+			script: "SELECT 1;\n" + NoTransactionDirective,
+			want:   false,
+		},
+		{name: "no directive", script: "-- comment\nSELECT 1;", want: false},
+		{
+			name:   "directive with suffix",
+			script: NoTransactionDirective + "-please\nSELECT 1;",
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasNoTransactionDirective(tt.script); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+const (
+	defaultLockName    = "migrations"
+	defaultLockTimeout = 5 * time.Minute
+	lockPollInterval   = 500 * time.Millisecond
+)
+
+const (
+	TryAdvisoryLock = `
+		SELECT pg_try_advisory_lock($1)`
+	AdvisoryUnlock = `
+		SELECT pg_advisory_unlock($1)`
+)
+
+// migrationLock a session level advisory lock held on a dedicated connection
+type migrationLock struct {
+	conn *sqlx.Conn
+	key  int64
+}
+
+// Creates the advisory lock key from the lock scope
+func lockKey(scope string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(scope))
+	return int64(h.Sum64())
+}
+
+// Acquires the advisory lock, polling until it's acquired or the timeout
+// passes
+func acquireMigrationLock(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	key int64,
+	timeout time.Duration,
+) (*migrationLock, error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked := false
+		err = conn.GetContext(ctx, &locked, TryAdvisoryLock, key)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if locked {
+			return &migrationLock{
+				conn: conn,
+				key:  key,
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Releases the lock and the connection, if the unlock fails the connection
+// is discarded instead of being returned to the pool so the lock can't leak
+func (l *migrationLock) release() error {
+	unlocked := false
+	err := l.conn.GetContext(
+		context.Background(),
+		&unlocked,
+		AdvisoryUnlock,
+		l.key,
+	)
+	if err != nil || !unlocked {
+		l.conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+	}
+	l.conn.Close()
+	return err
+}
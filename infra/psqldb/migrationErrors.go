@@ -0,0 +1,47 @@
+package psqldb
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTargetNotApplied  = errors.New("rollback target migration not applied")
+	ErrEmptyDown         = errors.New("migration has no down script")
+	ErrUnknownMigration  = errors.New("migration not found")
+	ErrNoTransactionFunc = errors.New(
+		"go function migrations can't run without a transaction",
+	)
+)
+
+// ErrKeyMismatch is returned when an applied migration does not match the
+// provided migration at the same index
+type ErrKeyMismatch struct {
+	Index    int
+	Expected string
+	Actual   string
+}
+
+func (e *ErrKeyMismatch) Error() string {
+	return fmt.Sprintf(
+		"migration key missmatch at index %d: expected %s, applied %s",
+		e.Index,
+		e.Expected,
+		e.Actual,
+	)
+}
+
+// ErrMigrationFailed is returned when a statement of a migration fails, it
+// wraps the sql error
+type ErrMigrationFailed struct {
+	Key string
+	Err error
+}
+
+func (e *ErrMigrationFailed) Error() string {
+	return fmt.Sprintf("migration %s failed: %s", e.Key, e.Err.Error())
+}
+
+func (e *ErrMigrationFailed) Unwrap() error {
+	return e.Err
+}
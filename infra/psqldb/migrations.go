@@ -4,160 +4,586 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
+// MigrationOptions options for running migrations
+type MigrationOptions struct {
+	// Schema the migrations are applied to and where the migrations table
+	// lives, created if it doesn't exist, defaults to "public"
+	Schema string
+	// MigrationsTable name of the table the history is stored in, defaults
+	// to "migrations"
+	MigrationsTable string
+	// DisableHelpers skips installing the timestamp helper procedures, they
+	// are tracked separately in the <MigrationsTable>_helpers table
+	DisableHelpers bool
+	// LockName scopes the advisory lock taken while migrating, replicas of
+	// the same application must share it, defaults to "migrations"
+	LockName string
+	// LockTimeout how long to wait for the advisory lock, defaults to 5
+	// minutes
+	LockTimeout time.Duration
+	// DisableLock runs the migrations without taking the advisory lock
+	DisableLock bool
+	// ChecksumMode what to do when an applied migration was edited, defaults
+	// to ChecksumWarn
+	ChecksumMode ChecksumMode
+	// TransactionPerMigration commits after every migration instead of
+	// applying all pending migrations in a single transaction
+	TransactionPerMigration bool
+}
+
+// Schema name
+func (opts *MigrationOptions) schema() string {
+	if opts.Schema == "" {
+		return defaultSchema
+	}
+	return opts.Schema
+}
+
+// Migrations table name
+func (opts *MigrationOptions) tableName() string {
+	if opts.MigrationsTable == "" {
+		return defaultMigrationsTable
+	}
+	return opts.MigrationsTable
+}
+
+// Quoted and schema qualified migrations table
+func (opts *MigrationOptions) table() string {
+	return quoteIdentifier(opts.schema()) + "." + quoteIdentifier(opts.tableName())
+}
+
+// Formats a query template with the migrations table
+func (opts *MigrationOptions) query(template string) string {
+	return fmt.Sprintf(template, opts.table())
+}
+
+// Points the search path of the transaction to the schema so unqualified
+// names in migrations resolve to it
+func (opts *MigrationOptions) setSearchPath(
+	ctx context.Context,
+	tx *sqlx.Tx,
+) error {
+	_, err := tx.ExecContext(ctx, "SET LOCAL search_path TO "+opts.searchPath())
+	return err
+}
+
+// Search path with the schema first, public is kept so extensions installed
+// there stay usable
+func (opts *MigrationOptions) searchPath() string {
+	path := quoteIdentifier(opts.schema())
+	if opts.schema() != defaultSchema {
+		path += ", " + defaultSchema
+	}
+	return path
+}
+
+// Key of the advisory lock for these options
+func (opts *MigrationOptions) lockKey() int64 {
+	name := opts.LockName
+	if name == "" {
+		name = defaultLockName
+	}
+	return lockKey(opts.schema() + "/" + name)
+}
+
+// Runs fn while holding the advisory lock unless it's disabled
+func (opts *MigrationOptions) withLock(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	fn func() error,
+) error {
+	if opts.DisableLock {
+		return fn()
+	}
+
+	timeout := opts.LockTimeout
+	if timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+	lgr.Info("Acquiring migration lock")
+	lock, err := acquireMigrationLock(ctx, db, opts.lockKey(), timeout)
+	if err != nil {
+		lgr.Error("Failed acquiring migration lock", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := lock.release(); err != nil {
+			lgr.Warn("Failed releasing migration lock", zap.Error(err))
+		}
+	}()
+	return fn()
+}
+
+// RunMigrations applies the migrations that have not been applied yet using
+// the default options
 func RunMigrations(
 	ctx context.Context,
 	lgr *zap.Logger,
 	db *tsqlx.TracedDB,
 	migrations []MigrationScript,
 ) error {
+	return RunMigrationsWithOptions(
+		ctx,
+		lgr,
+		db,
+		migrations,
+		&MigrationOptions{},
+	)
+}
 
-	tx := db.MustBegin()
-	chck := ExistsEntity{}
+// RunMigrationsWithOptions applies the migrations that have not been applied
+// yet in a single transaction (or one per migration with
+// TransactionPerMigration), the transaction is rolled back if any of them
+// fail, migrations flagged NoTransaction commit the pending transaction and
+// run on their own. An advisory lock is held while migrating so that when
+// several replicas start at once only one applies the migrations while the
+// others wait and then verify the history, the lock is held on a dedicated
+// connection so the pool must allow at least two connections. Every statement
+// is run with ctx so a migration blocked on a table lock is cancelled once
+// ctx is done. Errors are either the underlying sql error, ErrLockTimeout,
+// *ErrKeyMismatch or *ErrMigrationFailed
+func RunMigrationsWithOptions(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) error {
+	return opts.withLock(ctx, lgr, db, func() error {
+		if !opts.DisableHelpers {
+			if err := installHelpers(ctx, lgr, db, opts); err != nil {
+				return err
+			}
+		}
+		return runMigrations(ctx, lgr, db, migrations, opts)
+	})
+}
+
+// RunTenantMigrations applies the same migrations to each of the schemas,
+// every schema gets its own migrations table and lock, it stops at the first
+// schema that fails
+func RunTenantMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+	schemas []string,
+) error {
+	for _, schema := range schemas {
+		topts := *opts
+		topts.Schema = schema
+		tlgr := lgr.With(zap.String("schema", schema))
+		err := RunMigrationsWithOptions(ctx, tlgr, db, migrations, &topts)
+		if err != nil {
+			return fmt.Errorf("schema %s: %w", schema, err)
+		}
+	}
+	return nil
+}
 
-	// - creating timestamp procedures if requried
-	err := tx.Get(ctx, &chck, CheckTimestampProceduresExist)
+func runMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
-		lgr.Error(
-			"Failed fetching procedure info",
-			zap.Error(err),
-		)
-		panic(fmt.Errorf("Failed fetching procedure info"))
+		return err
 	}
+	defer func() {
+		if err != nil && tx != nil {
+			tx.Rollback()
+		}
+	}()
+	chck := ExistsEntity{}
 
-	if !chck.Exists {
-		lgr.Info("Creating timestamp procedures")
-		tx.MustExec(timestampProcedures.Up)
+	if opts.schema() != defaultSchema {
+		_, err = tx.ExecContext(
+			ctx,
+			"CREATE SCHEMA IF NOT EXISTS "+quoteIdentifier(opts.schema()),
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: "schema", Err: err}
+		}
+	}
+	if err = opts.setSearchPath(ctx, tx); err != nil {
+		return err
 	}
 
 	// - creating migration table if required
-	err = tx.Get(ctx, &chck, CheckMigrationExists)
+	err = tx.GetContext(
+		ctx,
+		&chck,
+		checkMigrationExists,
+		opts.schema(),
+		opts.tableName(),
+	)
 	if err != nil {
 		lgr.Error(
 			"Failed fetching migration info",
 			zap.Error(err),
 		)
-		panic(fmt.Errorf("Failed fetching migration info"))
+		return err
 	}
 	var exMigrs []migrationEntity
 
 	if !chck.Exists {
 		lgr.Info("Creating migration table")
-		tx.MustExec(migrationTable.Up)
+		if _, err = tx.ExecContext(ctx, opts.query(migrationTable.Up)); err != nil {
+			return &ErrMigrationFailed{Key: "migration table", Err: err}
+		}
 		exMigrs = []migrationEntity{}
 	} else {
 		lgr.Info("Fetching migration history")
-		err = tx.Select(ctx, &exMigrs, GetAllMigrations)
+		err = tx.SelectContext(ctx, &exMigrs, opts.query(getAllMigrations))
 		if err != nil {
 			lgr.Error(
 				"failed to fetch migrations",
 				zap.Error(err),
 			)
-			panic(fmt.Errorf("Failed fetching migration"))
+			return err
 		}
 	}
 	sort.Slice(exMigrs, func(i, j int) bool {
 		return exMigrs[i].Index < exMigrs[j].Index
 	})
 
+	if chck.Exists {
+		err = upgradeChecksums(ctx, lgr, tx, opts, migrations, exMigrs)
+		if err != nil {
+			return err
+		}
+	}
+
 	exMigrsLen := len(exMigrs)
 
 	for idx, migr := range migrations {
-		if idx < exMigrsLen {
-			if migr.Key != exMigrs[idx].Key {
-				panic(fmt.Errorf("migration key missmatch"))
+		if idx >= exMigrsLen {
+			break
+		}
+		if migr.Key != exMigrs[idx].Key {
+			return &ErrKeyMismatch{
+				Index:    idx,
+				Expected: migr.Key,
+				Actual:   exMigrs[idx].Key,
 			}
-		} else {
-			lgr.Info("Running migration", zap.String("migration", migr.Key))
-			tx.MustExec(migr.Up)
-			tx.MustExec(AddMigration, migr.Key)
+		}
+		err = verifyChecksum(lgr, opts.ChecksumMode, migr, exMigrs[idx])
+		if err != nil {
+			return err
 		}
 	}
+
+	// - applying pending migrations, the current transaction is committed
+	// before non transactional migrations and after every migration if
+	// transactions are per migration so progress is recorded and a later run
+	// resumes from the failed migration
+	for idx := exMigrsLen; idx < len(migrations); idx++ {
+		migr := migrations[idx]
+		lgr.Info("Running migration", zap.String("migration", migr.Key))
+
+		if migr.NoTransaction {
+			if tx != nil {
+				if err = tx.Commit(); err != nil {
+					return err
+				}
+				tx = nil
+			}
+			if err = runNoTransaction(ctx, db, opts, migr); err != nil {
+				lgr.Error(
+					"Migration failed",
+					zap.String("migration", migr.Key),
+					zap.Error(err),
+				)
+				return &ErrMigrationFailed{Key: migr.Key, Err: err}
+			}
+			continue
+		}
+
+		if tx == nil {
+			ntx, berr := db.BeginTxx(ctx, nil)
+			if berr != nil {
+				return berr
+			}
+			tx = ntx
+			if err = opts.setSearchPath(ctx, tx); err != nil {
+				return err
+			}
+		}
+		if err = migr.up(ctx, tx); err != nil {
+			lgr.Error(
+				"Migration failed",
+				zap.String("migration", migr.Key),
+				zap.Error(err),
+			)
+			return &ErrMigrationFailed{Key: migr.Key, Err: err}
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			opts.query(addMigration),
+			migr.Key,
+			migr.Checksum(),
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: migr.Key, Err: err}
+		}
+		if opts.TransactionPerMigration {
+			if err = tx.Commit(); err != nil {
+				return err
+			}
+			tx = nil
+		}
+	}
+
+	if tx == nil {
+		return nil
+	}
 	return tx.Commit()
 }
 
+// Runs a migration outside of a transaction on a dedicated connection with
+// the search path pointed to the schema and records it afterwards, if the
+// migration succeeds but recording it fails it will be run again on the next
+// run so such migrations should be idempotent (IF NOT EXISTS etc.)
+func runNoTransaction(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	opts *MigrationOptions,
+	migr MigrationScript,
+) error {
+	if migr.UpFunc != nil {
+		return ErrNoTransactionFunc
+	}
+	if err := execNoTransaction(ctx, db, opts, migr.Up); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, opts.query(addMigration), migr.Key, migr.Checksum())
+	return err
+}
+
+// Rolls back a migration outside of a transaction and removes it from the
+// history afterwards, like runNoTransaction the Down script should be
+// idempotent (IF EXISTS etc.)
+func rollbackNoTransaction(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	opts *MigrationOptions,
+	migr MigrationScript,
+) error {
+	if migr.DownFunc != nil {
+		return ErrNoTransactionFunc
+	}
+	if err := execNoTransaction(ctx, db, opts, migr.Down); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, opts.query(removeMigration), migr.Key)
+	return err
+}
+
+// Runs the statements of the script one at a time on a dedicated connection
+// with the search path pointed to the schema, if a statement fails the ones
+// before it stay applied
+func execNoTransaction(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	opts *MigrationOptions,
+	script string,
+) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SET search_path TO "+opts.searchPath())
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "RESET search_path")
+
+	for _, stmt := range splitStatements(script) {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates the schema and migrations table if they don't exist or upgrades an
+// existing migrations table
+func ensureMigrationTable(
+	ctx context.Context,
+	lgr *zap.Logger,
+	tx *sqlx.Tx,
+	opts *MigrationOptions,
+) error {
+	if opts.schema() != defaultSchema {
+		_, err := tx.ExecContext(
+			ctx,
+			"CREATE SCHEMA IF NOT EXISTS "+quoteIdentifier(opts.schema()),
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: "schema", Err: err}
+		}
+	}
+
+	chck := ExistsEntity{}
+	err := tx.GetContext(
+		ctx,
+		&chck,
+		checkMigrationExists,
+		opts.schema(),
+		opts.tableName(),
+	)
+	if err != nil {
+		return err
+	}
+	if chck.Exists {
+		_, err = tx.ExecContext(ctx, opts.query(upgradeMigrationChecksum))
+	} else {
+		lgr.Info("Creating migration table")
+		_, err = tx.ExecContext(ctx, opts.query(migrationTable.Up))
+	}
+	if err != nil {
+		return &ErrMigrationFailed{Key: "migration table", Err: err}
+	}
+	return nil
+}
+
+// Fetches the applied migrations ordered by index, empty if the migrations
+// table doesn't exist yet
+func fetchMigrationHistory(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	opts *MigrationOptions,
+) ([]migrationEntity, error) {
+	chck := ExistsEntity{}
+	err := tx.GetContext(
+		ctx,
+		&chck,
+		checkMigrationExists,
+		opts.schema(),
+		opts.tableName(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	exMigrs := []migrationEntity{}
+	if !chck.Exists {
+		return exMigrs, nil
+	}
+	if err = tx.SelectContext(ctx, &exMigrs, opts.query(getAllMigrations)); err != nil {
+		return nil, err
+	}
+	sort.Slice(exMigrs, func(i, j int) bool {
+		return exMigrs[i].Index < exMigrs[j].Index
+	})
+	return exMigrs, nil
+}
+
+// MigrationScript a single migration, UpFunc and DownFunc can be used instead
+// of Up and Down for migrations that need code such as data backfills, the
+// functions run in the migration transaction and should run their statements
+// with ctx (ExecContext etc.) so they can be cancelled. NoTransaction runs Up
+// and Down outside of any transaction for statements such as CREATE INDEX
+// CONCURRENTLY or ALTER TYPE ... ADD VALUE, the statements of the script are
+// run one at a time since postgres runs a multi statement query in an
+// implicit transaction, it can't be combined with UpFunc or DownFunc
 type MigrationScript struct {
-	Key  string
-	Up   string
-	Down string
+	Key           string
+	Up            string
+	Down          string
+	UpFunc        func(ctx context.Context, tx *sqlx.Tx) error
+	DownFunc      func(ctx context.Context, tx *sqlx.Tx) error
+	NoTransaction bool
+}
+
+// Applies the migration
+func (m MigrationScript) up(ctx context.Context, tx *sqlx.Tx) error {
+	if m.UpFunc != nil {
+		return m.UpFunc(ctx, tx)
+	}
+	_, err := tx.ExecContext(ctx, m.Up)
+	return err
+}
+
+// Reverts the migration
+func (m MigrationScript) down(ctx context.Context, tx *sqlx.Tx) error {
+	if m.DownFunc != nil {
+		return m.DownFunc(ctx, tx)
+	}
+	_, err := tx.ExecContext(ctx, m.Down)
+	return err
+}
+
+// Checks if the migration can be rolled back
+func (m MigrationScript) hasDown() bool {
+	return m.Down != "" || m.DownFunc != nil
 }
 
 type migrationEntity struct {
 	Index           int        `db:"idx"`
 	Key             string     `db:"key"`
 	DateTimeCreated *time.Time `db:"datetimecreated"`
+	Checksum        *string    `db:"checksum"`
 }
 
-var timestampProcedures = MigrationScript{
-	Up: `
+const (
+	defaultSchema          = "public"
+	defaultMigrationsTable = "migrations"
+)
 
-	  CREATE OR REPLACE FUNCTION trigger_set_datetimecreated()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.dateTimeCreated = NOW();
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-
-		CREATE OR REPLACE FUNCTION trigger_set_date_time_created()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.date_time_created = NOW();
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-
-		CREATE OR REPLACE FUNCTION trigger_set_date_time_updated()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.date_time_updated = NOW();
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-
-		CREATE OR REPLACE FUNCTION trigger_set_event_time()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.event_time = NOW();
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-
-	  CREATE OR REPLACE FUNCTION version_update()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.version = OLD.version + 1;
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-		`,
-	Down: `
-	  DROP FUNCTION version_update();
-		DROP FUNCTION trigger_set_event_time();`,
+// Quotes a postgres identifier such as a schema or table name
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
+// Templates taking the qualified migrations table, the creation timestamp
+// uses a default rather than the helper trigger so the table doesn't depend
+// on the helper procedures
 var migrationTable = MigrationScript{
 	Up: `
-		CREATE TABLE migrations (
+		CREATE TABLE %s (
 			idx SERIAL,
 			key text PRIMARY KEY,
-			datetimecreated timestamp with time zone NULL
-		);
-		
-		CREATE TRIGGER set_migrations_datetimecreated
-		BEFORE INSERT ON migrations
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_datetimecreated();`,
+			datetimecreated timestamp with time zone NULL DEFAULT NOW(),
+			checksum text NULL
+		);`,
 	Down: `
-		DROP TRIGGER set_migrations_datetimecreated on migrations;
-		DROP TABLE Migrations;`,
+		DROP TABLE %s;`,
 }
 
+// Queries of the migrations table, checkMigrationExists takes the schema and
+// table name and the others are templates taking the qualified table
+const (
+	checkMigrationExists = `
+		SELECT EXISTS(
+			SELECT * FROM pg_tables
+			WHERE schemaname = $1 AND tablename = $2
+		) as exists`
+	getAllMigrations = `
+		SELECT * FROM %s`
+	addMigration = `
+		INSERT INTO %s (key, checksum) VALUES ($1, $2)`
+	removeMigration = `
+		DELETE FROM %s WHERE key = $1`
+)
+
+// Queries of the default public.migrations table and helper procedures, kept
+// for compatibility, migrations with other options or schemas aren't covered
+// by them
 const (
 	CheckTimestampProceduresExist = `
 		SELECT EXISTS(
@@ -166,9 +592,9 @@ const (
 				FROM pg_proc AS p
 				JOIN pg_namespace n ON p.pronamespace = n.oid
 				WHERE p.proname in (
-					'trigger_set_datetimecreated', 
+					'trigger_set_datetimecreated',
 					'trigger_set_datetimeupdated'
-					) 
+					)
 					AND n.nspname = 'public'
 			) as c
 			WHERE c.count = 2
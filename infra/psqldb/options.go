@@ -1,6 +1,48 @@
 package psqldb
 
+import "time"
+
 type DatabaseOptions struct {
 	ConnectionString    string
 	DatabaseServiceName string
+
+	// MaxOpenConns maximum open connections, 0 is unlimited
+	MaxOpenConns int
+	// MaxIdleConns maximum idle connections, 0 keeps the database/sql
+	// default of 2
+	MaxIdleConns int
+	// ConnMaxLifetime maximum time a connection is reused, 0 is unlimited
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime maximum time a connection stays idle, 0 is unlimited
+	ConnMaxIdleTime time.Duration
+
+	// PingTimeout timeout of each startup ping, defaults to 5 seconds
+	PingTimeout time.Duration
+	// PingRetries number of retries if the startup ping fails
+	PingRetries int
+	// PingBackoff initial delay between ping retries, doubled on every
+	// retry, defaults to 1 second
+	PingBackoff time.Duration
+
+	// ReadReplicas connection strings of the read replicas used by the
+	// RoutedDB, ConnectionString is the primary
+	ReadReplicas []string
+	// ReplicaStrategy how reads are spread across replicas, either
+	// ReplicaRoundRobin (default) or ReplicaLeastConnections
+	ReplicaStrategy string
+	// ReplicaHealthInterval interval between replica health checks,
+	// defaults to 10 seconds
+	ReplicaHealthInterval time.Duration
+
+	// SlowQueryThreshold queries taking at least this long are logged with
+	// the trace ids of their context, 0 disables slow query logging.
+	// Requires a logger factory, constructors without one fail with
+	// ErrSlowQueryLogger
+	SlowQueryThreshold time.Duration
+	// SlowQueryExplain runs EXPLAIN for slow statements in the background and
+	// attaches the plan to the log entry
+	SlowQueryExplain bool
+	// SlowQueryExplainInterval minimum time between plans of the same
+	// statement, defaults to 1 minute
+	SlowQueryExplainInterval time.Duration
 }
@@ -0,0 +1,56 @@
+package outbox
+
+import "time"
+
+// Options options for the outbox table and relay
+type Options struct {
+	// Table name of the outbox table, defaults to "outbox"
+	Table string
+	// PollInterval delay between polls when the outbox is drained, defaults
+	// to 1 second
+	PollInterval time.Duration
+	// BatchSize maximum messages claimed per poll, defaults to 100
+	BatchSize int
+	// MaxAttempts publish attempts before a message is left undelivered,
+	// defaults to 10
+	MaxAttempts int
+	// RetryBackoff initial delay before a failed message is retried, doubled
+	// on every attempt, defaults to 1 second
+	RetryBackoff time.Duration
+	// MaxBackoff upper bound of the retry delay, defaults to 5 minutes
+	MaxBackoff time.Duration
+	// PublishTimeout timeout of a single publish, the claimed batch stays
+	// locked while publishing, defaults to 30 seconds
+	PublishTimeout time.Duration
+	// ServiceName name of the message broker for dependency spans
+	ServiceName string
+}
+
+func (opts *Options) withDefaults() Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Table == "" {
+		o.Table = "outbox"
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.PublishTimeout <= 0 {
+		o.PublishTimeout = 30 * time.Second
+	}
+	return o
+}
@@ -0,0 +1,132 @@
+// Package outbox implements the transactional outbox pattern on top of
+// psqldb, events are written to an outbox table in the same transaction as
+// the changes they describe and a relay publishes them afterwards so they
+// aren't lost if the service crashes in between
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"github.com/BetaLixT/tsqlx"
+)
+
+// TraceparentHeader header carrying the w3c trace context of a message
+const TraceparentHeader = "traceparent"
+
+// Message an event to be published
+type Message struct {
+	Topic   string
+	Key     string
+	Payload []byte
+	Headers map[string]string
+}
+
+// IPublisher publishes messages to a broker, the traceparent of the publish
+// span is passed in the message headers and the context carries the trace of
+// the publish span. The context is cancelled when the relay is closed or the
+// PublishTimeout passes and Publish should return promptly once it is
+type IPublisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// Migration creates the outbox table and the index the relay polls pending
+// messages with, it has to be applied before the first Enqueue. The key is
+// up to the service, usually versioned like "0005_create_outbox" so the
+// migration can be loaded with psqldb.LoadMigrations
+func Migration(opts *Options, key string) psqldb.MigrationScript {
+	o := opts.withDefaults()
+	return psqldb.MigrationScript{
+		Key: key,
+		Up: fmt.Sprintf(`
+			CREATE TABLE %[1]s (
+				id BIGSERIAL PRIMARY KEY,
+				topic text NOT NULL,
+				key text NOT NULL DEFAULT '',
+				payload bytea NOT NULL,
+				headers jsonb NOT NULL DEFAULT '{}',
+				traceparent text NOT NULL DEFAULT '',
+				attempts int NOT NULL DEFAULT 0,
+				last_error text NULL,
+				available_at timestamp with time zone NOT NULL DEFAULT NOW(),
+				created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+				delivered_at timestamp with time zone NULL
+			);
+
+			CREATE INDEX %[1]s_pending_idx ON %[1]s (available_at)
+			WHERE delivered_at IS NULL;`,
+			o.Table,
+		),
+		Down: fmt.Sprintf(`
+			DROP TABLE %s;`,
+			o.Table,
+		),
+	}
+}
+
+// Enqueue writes the message to the outbox as part of the transaction, the
+// trace context of ctx is stored with it so the publish is traced as part of
+// the same trace
+func Enqueue(
+	ctx context.Context,
+	tx *tsqlx.TracedTx,
+	opts *Options,
+	msg Message,
+) error {
+	o := opts.withDefaults()
+	headers := msg.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	hdrs, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		fmt.Sprintf(insertMessage, o.Table),
+		msg.Topic,
+		msg.Key,
+		msg.Payload,
+		hdrs,
+		tracectx.Traceparent(ctx),
+	)
+	return err
+}
+
+// Query templates taking the outbox table
+const (
+	insertMessage = `
+		INSERT INTO %s (topic, key, payload, headers, traceparent)
+		VALUES ($1, $2, $3, $4, $5)`
+	claimMessages = `
+		SELECT id, topic, key, payload, headers, traceparent, attempts
+		FROM %s
+		WHERE delivered_at IS NULL AND available_at <= NOW() AND attempts < $2
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+	markDelivered = `
+		UPDATE %s SET delivered_at = NOW(), attempts = attempts + 1
+		WHERE id = $1`
+	markFailed = `
+		UPDATE %s
+		SET attempts = attempts + 1,
+			last_error = $2,
+			available_at = NOW() + $3 * interval '1 millisecond'
+		WHERE id = $1`
+)
+
+type messageEntity struct {
+	Id          int64  `db:"id"`
+	Topic       string `db:"topic"`
+	Key         string `db:"key"`
+	Payload     []byte `db:"payload"`
+	Headers     []byte `db:"headers"`
+	Traceparent string `db:"traceparent"`
+	Attempts    int    `db:"attempts"`
+}
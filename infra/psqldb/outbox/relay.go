@@ -0,0 +1,249 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/logger"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/backoff"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"github.com/BetaLixT/tsqlx"
+	"go.uber.org/zap"
+)
+
+// ITracer traces publishes without a context using the stored trace ids
+type ITracer interface {
+	TraceDependencyWithIds(
+		traceId string,
+		requestId string,
+		spanId string,
+		dependencyType string,
+		serviceName string,
+		commandName string,
+		success bool,
+		startTimestamp time.Time,
+		eventTimestamp time.Time,
+		fields map[string]string,
+	)
+}
+
+// Relay polls the outbox and publishes pending messages, rows are claimed
+// with FOR UPDATE SKIP LOCKED so several replicas can relay concurrently
+// without publishing a message twice
+type Relay struct {
+	db        *tsqlx.TracedDB
+	publisher IPublisher
+	tracer    ITracer
+	lgr       *zap.Logger
+	opts      Options
+
+	stop   chan struct{}
+	wg     *sync.WaitGroup
+	once   *sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRelay constructs a relay, Start has to be called for it to run
+func NewRelay(
+	db *tsqlx.TracedDB,
+	publisher IPublisher,
+	tracer ITracer,
+	lgrf logger.IFactory,
+	opts *Options,
+) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		tracer:    tracer,
+		lgr:       lgrf.Create(context.Background()),
+		opts:      opts.withDefaults(),
+		stop:      make(chan struct{}),
+		wg:        &sync.WaitGroup{},
+		once:      &sync.Once{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start starts relaying in the background
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Close stops the relay, the publish in progress is cancelled and the
+// messages of the batch that weren't published yet are left for the next run
+func (r *Relay) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Shutdown stops the relay and waits for the current batch to finish, if ctx
+// is done first the publish in progress is cancelled as with Close
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		r.cancel()
+		<-done
+	}
+	r.cancel()
+	return err
+}
+
+func (r *Relay) run() {
+	defer r.wg.Done()
+	for {
+		n, err := r.relayBatch(context.Background())
+		if err != nil {
+			r.lgr.Error("failed relaying outbox", zap.Error(err))
+		}
+
+		// keep draining while full batches are being claimed
+		wait := r.opts.PollInterval
+		if err == nil && n == r.opts.BatchSize {
+			wait = 0
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Claims and publishes a single batch, returns the number of claimed
+// messages
+func (r *Relay) relayBatch(ctx context.Context) (n int, err error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	msgs := []messageEntity{}
+	err = tx.Select(
+		ctx,
+		&msgs,
+		fmt.Sprintf(claimMessages, r.opts.Table),
+		r.opts.BatchSize,
+		r.opts.MaxAttempts,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range msgs {
+		// the relay is closing, the progress so far is committed and the
+		// rest of the batch is unlocked without counting an attempt
+		if r.ctx.Err() != nil {
+			break
+		}
+		perr := r.publish(r.ctx, msgs[i])
+		if perr != nil && r.ctx.Err() != nil {
+			break
+		}
+		if perr == nil {
+			_, err = tx.Exec(
+				ctx,
+				fmt.Sprintf(markDelivered, r.opts.Table),
+				msgs[i].Id,
+			)
+		} else {
+			r.lgr.Warn(
+				"failed publishing outbox message",
+				zap.Int64("id", msgs[i].Id),
+				zap.Int("attempts", msgs[i].Attempts+1),
+				zap.Error(perr),
+			)
+			_, err = tx.Exec(
+				ctx,
+				fmt.Sprintf(markFailed, r.opts.Table),
+				msgs[i].Id,
+				perr.Error(),
+				backoff.Delay(
+					r.opts.RetryBackoff,
+					r.opts.MaxBackoff,
+					msgs[i].Attempts+1,
+				).Milliseconds(),
+			)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(msgs), tx.Commit()
+}
+
+// Publishes a message as a dependency span of the request that enqueued it,
+// or of a new trace if it was enqueued without one
+func (r *Relay) publish(ctx context.Context, ent messageEntity) error {
+	msg := Message{
+		Topic:   ent.Topic,
+		Key:     ent.Key,
+		Payload: ent.Payload,
+		Headers: map[string]string{},
+	}
+	if err := json.Unmarshal(ent.Headers, &msg.Headers); err != nil {
+		return err
+	}
+
+	// the consumers continue the trace from the publish span
+	pctx, cancel := context.WithTimeout(ctx, r.opts.PublishTimeout)
+	defer cancel()
+	tctx := tracectx.New(pctx, ent.Traceparent)
+	span := tctx.Span()
+	msg.Headers[TraceparentHeader] = span.TraceParent()
+
+	start := time.Now()
+	err := r.publisher.Publish(tctx, msg)
+	end := time.Now()
+
+	if r.tracer != nil {
+		fields := map[string]string{
+			"topic":    msg.Topic,
+			"key":      msg.Key,
+			"attempts": strconv.Itoa(ent.Attempts + 1),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		r.tracer.TraceDependencyWithIds(
+			span.TraceIdString(),
+			tctx.ParentId(),
+			span.SpanIdString(),
+			"outbox",
+			r.opts.ServiceName,
+			"Publish "+msg.Topic,
+			err == nil,
+			start, end,
+			fields,
+		)
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+// Package pgerr classifies PostgreSQL driver errors into typed errors by their
+// SQLSTATE code so they can be checked with errors.Is and errors.As instead of
+// matching error messages
+package pgerr
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrNotNullViolation     = errors.New("not null violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrDeadlockDetected     = errors.New("deadlock detected")
+	ErrQueryCanceled        = errors.New("query canceled")
+	ErrConnectionLost       = errors.New("connection lost")
+)
+
+// SQLSTATE codes that are classified
+const (
+	CodeUniqueViolation      = "23505"
+	CodeForeignKeyViolation  = "23503"
+	CodeNotNullViolation     = "23502"
+	CodeCheckViolation       = "23514"
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+	CodeQueryCanceled        = "57014"
+	CodeAdminShutdown        = "57P01"
+	CodeCrashShutdown        = "57P02"
+	CodeCannotConnectNow     = "57P03"
+)
+
+var sentinels = map[string]error{
+	CodeUniqueViolation:      ErrUniqueViolation,
+	CodeForeignKeyViolation:  ErrForeignKeyViolation,
+	CodeNotNullViolation:     ErrNotNullViolation,
+	CodeCheckViolation:       ErrCheckViolation,
+	CodeSerializationFailure: ErrSerializationFailure,
+	CodeDeadlockDetected:     ErrDeadlockDetected,
+	CodeQueryCanceled:        ErrQueryCanceled,
+	CodeAdminShutdown:        ErrConnectionLost,
+	CodeCrashShutdown:        ErrConnectionLost,
+	CodeCannotConnectNow:     ErrConnectionLost,
+}
+
+// Error a classified postgres error, errors.Is matches its sentinel and
+// errors.As/Unwrap reach the driver error
+type Error struct {
+	Code       string
+	Constraint string
+	Table      string
+	Column     string
+	Message    string
+
+	kind error
+	err  error
+}
+
+func (e *Error) Error() string {
+	if e.Constraint != "" {
+		return e.kind.Error() + " (" + e.Constraint + "): " + e.err.Error()
+	}
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+// Is matches the sentinel the error was classified as
+func (e *Error) Is(target error) bool {
+	return e.kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Kind the sentinel the error was classified as
+func (e *Error) Kind() error {
+	return e.kind
+}
+
+// SQLState extracts the SQLSTATE code of a driver error, empty if there is
+// none
+func SQLState(err error) string {
+	var serr interface{ SQLState() string }
+	if errors.As(err, &serr) {
+		return serr.SQLState()
+	}
+	return ""
+}
+
+// Classify maps the error to an *Error if it's a postgres error with a known
+// SQLSTATE code or a lost connection, other errors (including nil) are
+// returned as is
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var cerr *Error
+	if errors.As(err, &cerr) {
+		return err
+	}
+
+	code := SQLState(err)
+	kind, ok := sentinels[code]
+	if !ok {
+		// class 08 covers all connection exceptions
+		if strings.HasPrefix(code, "08") || isConnectionLost(err) {
+			kind = ErrConnectionLost
+		} else {
+			return err
+		}
+	}
+
+	cerr = &Error{
+		Code:    code,
+		Message: err.Error(),
+		kind:    kind,
+		err:     err,
+	}
+	var perr *pq.Error
+	if errors.As(err, &perr) {
+		cerr.Constraint = perr.Constraint
+		cerr.Table = perr.Table
+		cerr.Column = perr.Column
+		cerr.Message = perr.Message
+	}
+	return cerr
+}
+
+// Is classifies the error and checks it against the sentinel
+func Is(err error, target error) bool {
+	return errors.Is(Classify(err), target)
+}
+
+// IsRetryable checks if the error is a transient failure that can be fixed
+// by retrying the transaction
+func IsRetryable(err error) bool {
+	err = Classify(err)
+	return errors.Is(err, ErrSerializationFailure) ||
+		errors.Is(err, ErrDeadlockDetected)
+}
+
+// HTTPStatus maps the error to the http status code it should usually
+// result in, 500 for errors that aren't classified
+func HTTPStatus(err error) int {
+	err = Classify(err)
+	switch {
+	case errors.Is(err, ErrUniqueViolation),
+		errors.Is(err, ErrSerializationFailure),
+		errors.Is(err, ErrDeadlockDetected):
+		return http.StatusConflict
+	case errors.Is(err, ErrForeignKeyViolation),
+		errors.Is(err, ErrNotNullViolation),
+		errors.Is(err, ErrCheckViolation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrQueryCanceled):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrConnectionLost):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Errors without a SQLSTATE that mean the connection to the server is gone,
+// context errors are deliberately not treated as lost connections
+func isConnectionLost(err error) bool {
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
@@ -0,0 +1,253 @@
+package pgerr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		code string
+	}{
+		{name: "nil", err: nil},
+		{name: "unclassified", err: errors.New("boom")},
+		{name: "no rows", err: sql.ErrNoRows},
+		{
+			name: "unique violation",
+			err:  &pq.Error{Code: CodeUniqueViolation},
+			kind: ErrUniqueViolation,
+			code: CodeUniqueViolation,
+		},
+		{
+			name: "wrapped unique violation",
+			err:  fmt.Errorf("insert user: %w", &pq.Error{Code: CodeUniqueViolation}),
+			kind: ErrUniqueViolation,
+			code: CodeUniqueViolation,
+		},
+		{
+			name: "foreign key violation",
+			err:  &pq.Error{Code: CodeForeignKeyViolation},
+			kind: ErrForeignKeyViolation,
+			code: CodeForeignKeyViolation,
+		},
+		{
+			name: "not null violation",
+			err:  &pq.Error{Code: CodeNotNullViolation},
+			kind: ErrNotNullViolation,
+			code: CodeNotNullViolation,
+		},
+		{
+			name: "check violation",
+			err:  &pq.Error{Code: CodeCheckViolation},
+			kind: ErrCheckViolation,
+			code: CodeCheckViolation,
+		},
+		{
+			name: "serialization failure",
+			err:  &pq.Error{Code: CodeSerializationFailure},
+			kind: ErrSerializationFailure,
+			code: CodeSerializationFailure,
+		},
+		{
+			name: "deadlock",
+			err:  &pq.Error{Code: CodeDeadlockDetected},
+			kind: ErrDeadlockDetected,
+			code: CodeDeadlockDetected,
+		},
+		{
+			name: "query canceled",
+			err:  &pq.Error{Code: CodeQueryCanceled},
+			kind: ErrQueryCanceled,
+			code: CodeQueryCanceled,
+		},
+		{
+			name: "admin shutdown",
+			err:  &pq.Error{Code: CodeAdminShutdown},
+			kind: ErrConnectionLost,
+			code: CodeAdminShutdown,
+		},
+		{
+			name: "connection exception class",
+			err:  &pq.Error{Code: "08006"},
+			kind: ErrConnectionLost,
+			code: "08006",
+		},
+		{name: "unknown code", err: &pq.Error{Code: "42P01"}},
+		{name: "bad conn", err: driver.ErrBadConn, kind: ErrConnectionLost},
+		{name: "eof", err: io.EOF, kind: ErrConnectionLost},
+		{
+			name: "unexpected eof",
+			err:  fmt.Errorf("read: %w", io.ErrUnexpectedEOF),
+			kind: ErrConnectionLost,
+		},
+		{
+			name: "dial error",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("refused")},
+			kind: ErrConnectionLost,
+		},
+		{name: "context canceled", err: context.Canceled},
+		{name: "deadline exceeded", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.err)
+			if tt.kind == nil {
+				if got != tt.err {
+					t.Fatalf("expected error to be returned as is, got %v", got)
+				}
+				return
+			}
+
+			var cerr *Error
+			if !errors.As(got, &cerr) {
+				t.Fatalf("expected *Error, got %T", got)
+			}
+			if !errors.Is(got, tt.kind) || cerr.Kind() != tt.kind {
+				t.Errorf("expected kind %v, got %v", tt.kind, cerr.Kind())
+			}
+			if cerr.Code != tt.code {
+				t.Errorf("expected code %q, got %q", tt.code, cerr.Code)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Error("expected the driver error to stay reachable")
+			}
+			if Classify(got) != got {
+				t.Error("expected classifying twice to be a no-op")
+			}
+		})
+	}
+}
+
+func TestClassifyDetails(t *testing.T) {
+	perr := &pq.Error{
+		Code:       CodeUniqueViolation,
+		Message:    "duplicate key value",
+		Constraint: "users_email_key",
+		Table:      "users",
+		Column:     "email",
+	}
+	var cerr *Error
+	if !errors.As(Classify(perr), &cerr) {
+		t.Fatal("expected *Error")
+	}
+	if cerr.Constraint != "users_email_key" ||
+		cerr.Table != "users" ||
+		cerr.Column != "email" ||
+		cerr.Message != "duplicate key value" {
+		t.Errorf("unexpected details %+v", cerr)
+	}
+
+	var got *pq.Error
+	if !errors.As(cerr, &got) || got != perr {
+		t.Error("expected errors.As to reach the driver error")
+	}
+}
+
+func TestSQLState(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "plain", err: errors.New("boom"), want: ""},
+		{name: "pq", err: &pq.Error{Code: "23505"}, want: "23505"},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("wrap: %w", &pq.Error{Code: "40001"}),
+			want: "40001",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SQLState(tt.err); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{
+			name: "serialization",
+			err:  &pq.Error{Code: CodeSerializationFailure},
+			want: true,
+		},
+		{
+			name: "deadlock",
+			err:  &pq.Error{Code: CodeDeadlockDetected},
+			want: true,
+		},
+		{
+			name: "unique",
+			err:  &pq.Error{Code: CodeUniqueViolation},
+			want: false,
+		},
+		{name: "connection lost", err: io.EOF, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{code: CodeUniqueViolation, want: http.StatusConflict},
+		{code: CodeSerializationFailure, want: http.StatusConflict},
+		{code: CodeDeadlockDetected, want: http.StatusConflict},
+		{code: CodeForeignKeyViolation, want: http.StatusUnprocessableEntity},
+		{code: CodeNotNullViolation, want: http.StatusUnprocessableEntity},
+		{code: CodeCheckViolation, want: http.StatusUnprocessableEntity},
+		{code: CodeQueryCanceled, want: http.StatusGatewayTimeout},
+		{code: CodeCannotConnectNow, want: http.StatusServiceUnavailable},
+		{code: "42P01", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got := HTTPStatus(&pq.Error{Code: pq.ErrorCode(tt.code)})
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	if got := HTTPStatus(errors.New("boom")); got != http.StatusInternalServerError {
+		t.Errorf("expected unclassified errors to be 500, got %d", got)
+	}
+}
+
+func TestIs(t *testing.T) {
+	err := fmt.Errorf("wrap: %w", &pq.Error{Code: CodeUniqueViolation})
+	if !Is(err, ErrUniqueViolation) {
+		t.Error("expected unique violation")
+	}
+	if Is(err, ErrForeignKeyViolation) {
+		t.Error("expected no foreign key violation")
+	}
+}
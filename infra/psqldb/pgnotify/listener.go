@@ -0,0 +1,323 @@
+// Package pgnotify subscribes to postgres LISTEN/NOTIFY channels over a
+// dedicated connection
+package pgnotify
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/logger"
+	"github.com/BetaLixT/gowebstd/infra/psqldb"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"github.com/BetaLixT/tsqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAlreadySubscribed = errors.New("channel already subscribed")
+	ErrNotSubscribed     = errors.New("channel not subscribed")
+	ErrListenerClosed    = errors.New("listener closed")
+	ErrConnectTimeout    = errors.New("listener timed out connecting")
+)
+
+// ITracer traces received notifications as consumer spans
+type ITracer interface {
+	TraceEvent(
+		ctx context.Context,
+		name string,
+		key string,
+		statusCode int,
+		startTimestamp time.Time,
+		eventTimestamp time.Time,
+		fields map[string]string,
+	)
+}
+
+// Notification a notification received on a channel, Ctx carries the trace
+// of the notification
+type Notification struct {
+	Ctx        context.Context
+	Channel    string
+	Payload    string
+	BackendPid int
+}
+
+// Listener listens to channels on a dedicated connection, the connection is
+// reestablished with backoff when lost and all channels are listened to again
+type Listener struct {
+	pql    *pq.Listener
+	tracer ITracer
+	lgr    *zap.Logger
+	opts   Options
+
+	mtx    *sync.RWMutex
+	subs   map[string]*subscription
+	closed bool
+	done   chan struct{}
+	wg     *sync.WaitGroup
+
+	// result of the first connection attempt
+	connected chan error
+}
+
+type subscription struct {
+	ch chan Notification
+}
+
+// NewListener creates a listener using the connection string of the
+// database options
+func NewListener(
+	optn *psqldb.DatabaseOptions,
+	tracer ITracer,
+	lgrf logger.IFactory,
+	opts *Options,
+) (*Listener, error) {
+	o := opts.withDefaults()
+	lgr := lgrf.Create(context.Background())
+
+	l := &Listener{
+		tracer: tracer,
+		lgr:    lgr,
+		opts:   o,
+		mtx:    &sync.RWMutex{},
+		subs:   map[string]*subscription{},
+		done:   make(chan struct{}),
+		wg:     &sync.WaitGroup{},
+
+		connected: make(chan error, 1),
+	}
+	l.pql = pq.NewListener(
+		optn.ConnectionString,
+		o.MinReconnectInterval,
+		o.MaxReconnectInterval,
+		l.onEvent,
+	)
+
+	// the listener connects in the background, fail early if the database
+	// can't be reached
+	select {
+	case err := <-l.connected:
+		if err != nil {
+			l.pql.Close()
+			return nil, err
+		}
+	case <-time.After(o.ConnectTimeout):
+		l.pql.Close()
+		return nil, ErrConnectTimeout
+	}
+
+	l.wg.Add(1)
+	go l.dispatch()
+	return l, nil
+}
+
+// Subscribe listens to the channel, notifications are delivered on the
+// returned go channel which is closed on Unsubscribe or Close. Notifications
+// are dropped if the go channel isn't drained fast enough
+func (l *Listener) Subscribe(channel string) (<-chan Notification, error) {
+	sub, err := l.subscribe(channel)
+	if err != nil {
+		return nil, err
+	}
+	return sub.ch, nil
+}
+
+// SubscribeFunc listens to the channel, fn is called for every notification
+// in order from a dedicated routine
+func (l *Listener) SubscribeFunc(
+	channel string,
+	fn func(Notification),
+) error {
+	sub, err := l.subscribe(channel)
+	if err != nil {
+		return err
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for n := range sub.ch {
+			fn(n)
+		}
+	}()
+	return nil
+}
+
+// Unsubscribe stops listening to the channel
+func (l *Listener) Unsubscribe(channel string) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return ErrListenerClosed
+	}
+	sub, ok := l.subs[channel]
+	if !ok {
+		return ErrNotSubscribed
+	}
+	if err := l.pql.Unlisten(channel); err != nil {
+		return err
+	}
+	delete(l.subs, channel)
+	close(sub.ch)
+	return nil
+}
+
+// Close closes the connection and all subscriptions, waiting for running
+// callbacks to return
+func (l *Listener) Close() error {
+	l.mtx.Lock()
+	if l.closed {
+		l.mtx.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	err := l.pql.Close()
+	for channel, sub := range l.subs {
+		close(sub.ch)
+		delete(l.subs, channel)
+	}
+	l.mtx.Unlock()
+
+	l.wg.Wait()
+	return err
+}
+
+func (l *Listener) subscribe(channel string) (*subscription, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return nil, ErrListenerClosed
+	}
+	if _, ok := l.subs[channel]; ok {
+		return nil, ErrAlreadySubscribed
+	}
+	if err := l.pql.Listen(channel); err != nil {
+		return nil, err
+	}
+	sub := &subscription{
+		ch: make(chan Notification, l.opts.BufferSize),
+	}
+	l.subs[channel] = sub
+	return sub, nil
+}
+
+// Routes notifications to their subscriptions, pings the connection when
+// idle so a silently dropped connection is detected
+func (l *Listener) dispatch() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case n, ok := <-l.pql.Notify:
+			if !ok {
+				return
+			}
+			// a nil notification is sent after reconnecting, notifications
+			// sent while disconnected are lost
+			if n == nil {
+				l.lgr.Warn("listener reconnected, notifications may have been missed")
+				continue
+			}
+			l.deliver(n)
+		case <-ticker.C:
+			go func() {
+				if err := l.pql.Ping(); err != nil {
+					l.lgr.Warn("listener ping failed", zap.Error(err))
+				}
+			}()
+		}
+	}
+}
+
+func (l *Listener) deliver(n *pq.Notification) {
+	start := time.Now()
+	// postgres doesn't carry trace context with notifications so every
+	// notification starts a new trace
+	ctx := tracectx.New(context.Background(), "")
+	notif := Notification{
+		Ctx:        ctx,
+		Channel:    n.Channel,
+		Payload:    n.Extra,
+		BackendPid: n.BePid,
+	}
+
+	status := 200
+	l.mtx.RLock()
+	sub, ok := l.subs[n.Channel]
+	if ok {
+		select {
+		case sub.ch <- notif:
+		default:
+			status = 503
+			l.lgr.Warn(
+				"subscription buffer full, notification dropped",
+				zap.String("channel", n.Channel),
+			)
+		}
+	}
+	l.mtx.RUnlock()
+	if !ok {
+		return
+	}
+
+	if l.tracer != nil {
+		l.tracer.TraceEvent(
+			ctx,
+			"NOTIFY "+n.Channel,
+			n.Channel,
+			status,
+			start,
+			time.Now(),
+			map[string]string{
+				"channel":    n.Channel,
+				"backendPid": strconv.Itoa(n.BePid),
+			},
+		)
+	}
+}
+
+// Logs connection state changes of the underlying listener
+func (l *Listener) onEvent(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventConnected:
+		l.lgr.Info("listener connected")
+		l.signalConnected(nil)
+	case pq.ListenerEventDisconnected:
+		l.lgr.Warn("listener disconnected", zap.Error(err))
+	case pq.ListenerEventReconnected:
+		l.lgr.Info("listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.lgr.Warn("listener connection attempt failed", zap.Error(err))
+		l.signalConnected(err)
+	}
+}
+
+// Reports the first connection attempt to NewListener, later attempts are
+// dropped
+func (l *Listener) signalConnected(err error) {
+	select {
+	case l.connected <- err:
+	default:
+	}
+}
+
+// Notify sends a notification on the channel, it is delivered when the
+// transaction commits if sent within one
+func Notify(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	channel string,
+	payload string,
+) error {
+	_, err := db.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
@@ -0,0 +1,46 @@
+package pgnotify
+
+import "time"
+
+// Options options for the notification listener
+type Options struct {
+	// MinReconnectInterval initial delay before reconnecting after the
+	// connection is lost, doubled on every failed attempt, defaults to
+	// 1 second
+	MinReconnectInterval time.Duration
+	// MaxReconnectInterval upper bound of the reconnect delay, defaults to
+	// 1 minute
+	MaxReconnectInterval time.Duration
+	// PingInterval interval of idle connection health checks, defaults to
+	// 90 seconds
+	PingInterval time.Duration
+	// ConnectTimeout time NewListener waits for the first connection,
+	// defaults to 10 seconds
+	ConnectTimeout time.Duration
+	// BufferSize notifications buffered per subscription before further
+	// notifications are dropped, defaults to 64
+	BufferSize int
+}
+
+func (opts *Options) withDefaults() Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MinReconnectInterval <= 0 {
+		o.MinReconnectInterval = time.Second
+	}
+	if o.MaxReconnectInterval <= 0 {
+		o.MaxReconnectInterval = time.Minute
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 90 * time.Second
+	}
+	if o.ConnectTimeout <= 0 {
+		o.ConnectTimeout = 10 * time.Second
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = 64
+	}
+	return o
+}
@@ -0,0 +1,184 @@
+// Package psqltest sets up isolated postgres schemas for tests, every test
+// gets its own schema with the migrations of the service applied which is
+// dropped once the test is done
+package psqltest
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb"
+	"github.com/BetaLixT/tsqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap/zaptest"
+)
+
+// DefaultEnvVar environment variable the connection string is read from
+const DefaultEnvVar = "TEST_DATABASE_URL"
+
+// Options options for the test database
+type Options struct {
+	// EnvVar environment variable holding the connection string, defaults to
+	// TEST_DATABASE_URL
+	EnvVar string
+	// Migration options of the service, the schema is always replaced by the
+	// schema of the test
+	Migration *psqldb.MigrationOptions
+	// Tracer tracer of the database, queries aren't traced by default
+	Tracer tsqlx.ITracer
+	// PingTimeout time to wait for the database before skipping the test,
+	// defaults to 2 seconds
+	PingTimeout time.Duration
+	// KeepSchema leaves the schema in place after the test for inspection
+	KeepSchema bool
+}
+
+// Database a database bound to the schema of a test
+type Database struct {
+	DB     *tsqlx.TracedDB
+	Schema string
+}
+
+// New creates a schema for the test, applies the migrations to it and
+// returns a database whose search_path is the schema. The schema is dropped
+// and the database closed when the test finishes. The test is skipped if the
+// connection string isn't set or the database can't be reached
+func New(
+	t testing.TB,
+	migrations []psqldb.MigrationScript,
+	opts *Options,
+) *Database {
+	t.Helper()
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.EnvVar == "" {
+		o.EnvVar = DefaultEnvVar
+	}
+	if o.Tracer == nil {
+		o.Tracer = &noopTracer{}
+	}
+	if o.PingTimeout <= 0 {
+		o.PingTimeout = 2 * time.Second
+	}
+
+	connStr := os.Getenv(o.EnvVar)
+	if connStr == "" {
+		t.Skipf("%s not set, skipping database test", o.EnvVar)
+	}
+
+	schema := schemaName(t.Name())
+	bound, err := withSearchPath(connStr, schema)
+	if err != nil {
+		t.Fatalf("invalid connection string: %v", err)
+	}
+	db, err := psqldb.NewDatabaseContext(o.Tracer, &psqldb.DatabaseOptions{
+		ConnectionString:    bound,
+		DatabaseServiceName: "psqltest",
+		PingTimeout:         o.PingTimeout,
+	})
+	if err != nil {
+		t.Skipf("database not available, skipping database test: %v", err)
+	}
+
+	t.Cleanup(func() {
+		defer db.Close()
+		if o.KeepSchema {
+			t.Logf("keeping test schema %s", schema)
+			return
+		}
+		_, err := db.Exec(
+			context.Background(),
+			"DROP SCHEMA IF EXISTS "+pq.QuoteIdentifier(schema)+" CASCADE",
+		)
+		if err != nil {
+			t.Errorf("failed dropping test schema %s: %v", schema, err)
+		}
+	})
+
+	mopts := psqldb.MigrationOptions{}
+	if o.Migration != nil {
+		mopts = *o.Migration
+	}
+	mopts.Schema = schema
+	err = psqldb.RunMigrationsWithOptions(
+		context.Background(),
+		zaptest.NewLogger(t),
+		db,
+		migrations,
+		&mopts,
+	)
+	if err != nil {
+		t.Fatalf("failed migrating test schema %s: %v", schema, err)
+	}
+
+	return &Database{
+		DB:     db,
+		Schema: schema,
+	}
+}
+
+// Builds a unique schema name from the test name, postgres identifiers are
+// limited to 63 bytes
+func schemaName(name string) string {
+	b := strings.Builder{}
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	base := b.String()
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	suffix := make([]byte, 6)
+	crand.Read(suffix)
+	return fmt.Sprintf("test_%s_%s", base, hex.EncodeToString(suffix))
+}
+
+// Sets the search_path of the connection string to the schema followed by
+// public, the same path the migrations are run with so extensions installed
+// in public stay usable. Both url and key value connection strings are
+// supported
+func withSearchPath(connStr string, schema string) (string, error) {
+	path := schema + ",public"
+	if strings.HasPrefix(connStr, "postgres://") ||
+		strings.HasPrefix(connStr, "postgresql://") {
+		u, err := url.Parse(connStr)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("search_path", path)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return fmt.Sprintf("%s search_path='%s'", connStr, path), nil
+}
+
+// noopTracer test queries aren't traced unless a tracer is provided
+type noopTracer struct{}
+
+func (*noopTracer) TraceDependency(
+	ctx context.Context,
+	spanId string,
+	dependencyType string,
+	serviceName string,
+	commandName string,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) {
+}
@@ -0,0 +1,38 @@
+package psqltest
+
+import "testing"
+
+func TestWithSearchPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		connStr string
+		want    string
+	}{
+		{
+			name:    "url",
+			connStr: "postgres://user@localhost:5432/app?sslmode=disable",
+			want:    "postgres://user@localhost:5432/app?search_path=test_a%2Cpublic&sslmode=disable",
+		},
+		{
+			name:    "postgresql url",
+			connStr: "postgresql://localhost/app",
+			want:    "postgresql://localhost/app?search_path=test_a%2Cpublic",
+		},
+		{
+			name:    "key value",
+			connStr: "host=localhost dbname=app",
+			want:    "host=localhost dbname=app search_path='test_a,public'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withSearchPath(tt.connStr, "test_a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
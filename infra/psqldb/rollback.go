@@ -0,0 +1,220 @@
+package psqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// RollbackMigrations rolls back applied migrations in reverse order, running
+// their Down scripts and removing them from the migrations table, until
+// targetKey is the latest applied migration. An empty targetKey rolls back
+// every migration. Nothing is run if any of the migrations to be rolled back
+// has neither a Down script nor a DownFunc. NoTransaction migrations are
+// rolled back outside of the transaction, so a failure after one of them
+// leaves the rollback partially applied
+func RollbackMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+) error {
+	return RollbackMigrationsWithOptions(
+		ctx,
+		lgr,
+		db,
+		migrations,
+		targetKey,
+		&MigrationOptions{},
+	)
+}
+
+// RollbackMigrationsWithOptions RollbackMigrations with migration options
+func RollbackMigrationsWithOptions(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) error {
+	return opts.withLock(ctx, lgr, db, func() error {
+		return rollbackMigrations(ctx, lgr, db, migrations, targetKey, opts)
+	})
+}
+
+func rollbackMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	plan, err := planRollback(ctx, tx, migrations, targetKey, opts)
+	if err != nil {
+		return err
+	}
+	if err = opts.setSearchPath(ctx, tx); err != nil {
+		return err
+	}
+
+	// - the current transaction is committed before non transactional
+	// migrations are rolled back, same as when applying them
+	for _, migr := range plan {
+		lgr.Info("Rolling back migration", zap.String("migration", migr.Key))
+
+		if migr.NoTransaction {
+			if tx != nil {
+				if err = tx.Commit(); err != nil {
+					return err
+				}
+				tx = nil
+			}
+			if err = rollbackNoTransaction(ctx, db, opts, migr); err != nil {
+				return &ErrMigrationFailed{Key: migr.Key, Err: err}
+			}
+			continue
+		}
+
+		if tx == nil {
+			ntx, berr := db.BeginTxx(ctx, nil)
+			if berr != nil {
+				return berr
+			}
+			tx = ntx
+			if err = opts.setSearchPath(ctx, tx); err != nil {
+				return err
+			}
+		}
+		if err = migr.down(ctx, tx); err != nil {
+			return &ErrMigrationFailed{Key: migr.Key, Err: err}
+		}
+		_, err = tx.ExecContext(ctx, opts.query(removeMigration), migr.Key)
+		if err != nil {
+			return &ErrMigrationFailed{Key: migr.Key, Err: err}
+		}
+	}
+
+	if tx == nil {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// PlanRollback is the dry run of RollbackMigrations, it returns the keys of
+// the migrations that would be rolled back in the order they would be rolled
+// back without changing anything
+func PlanRollback(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+) ([]string, error) {
+	return PlanRollbackWithOptions(
+		ctx,
+		lgr,
+		db,
+		migrations,
+		targetKey,
+		&MigrationOptions{},
+	)
+}
+
+// PlanRollbackWithOptions PlanRollback with migration options
+func PlanRollbackWithOptions(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) ([]string, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	plan, err := planRollback(ctx, tx, migrations, targetKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(plan))
+	for i, migr := range plan {
+		lgr.Info("Migration would be rolled back", zap.String("migration", migr.Key))
+		keys[i] = migr.Key
+	}
+	return keys, nil
+}
+
+// Resolves the migrations to be rolled back in reverse order of application
+func planRollback(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) ([]MigrationScript, error) {
+	exMigrs, err := fetchMigrationHistory(ctx, tx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(exMigrs) > len(migrations) {
+		return nil, fmt.Errorf(
+			"%d migrations applied but only %d provided",
+			len(exMigrs),
+			len(migrations),
+		)
+	}
+
+	target := -1
+	for idx := range exMigrs {
+		if migrations[idx].Key != exMigrs[idx].Key {
+			return nil, &ErrKeyMismatch{
+				Index:    idx,
+				Expected: migrations[idx].Key,
+				Actual:   exMigrs[idx].Key,
+			}
+		}
+		if exMigrs[idx].Key == targetKey {
+			target = idx
+		}
+	}
+	if targetKey != "" && target == -1 {
+		return nil, fmt.Errorf("%w: %s", ErrTargetNotApplied, targetKey)
+	}
+
+	plan := make([]MigrationScript, 0, len(exMigrs)-target-1)
+	for idx := len(exMigrs) - 1; idx > target; idx-- {
+		if !migrations[idx].hasDown() {
+			return nil, fmt.Errorf("%w: %s", ErrEmptyDown, migrations[idx].Key)
+		}
+		if migrations[idx].NoTransaction && migrations[idx].DownFunc != nil {
+			return nil, fmt.Errorf(
+				"%w: %s",
+				ErrNoTransactionFunc,
+				migrations[idx].Key,
+			)
+		}
+		plan = append(plan, migrations[idx])
+	}
+	return plan, nil
+}
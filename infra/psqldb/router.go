@@ -0,0 +1,292 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/cntxt"
+	"github.com/BetaLixT/gowebstd/externals/logger"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/pgerr"
+	"github.com/BetaLixT/tsqlx"
+)
+
+// Strategies for spreading reads across replicas
+const (
+	ReplicaRoundRobin       = "round-robin"
+	ReplicaLeastConnections = "least-connections"
+)
+
+const defaultReplicaHealthInterval = 10 * time.Second
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites flags the context so that reads through a RoutedDB go to
+// the primary, for reads that must see writes made just before them. The
+// flag is set on the context itself if it's an IContext so trace information
+// isn't lost
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if ictx, ok := ctx.(cntxt.IContext); ok {
+		ictx.WithValue(readYourWritesKey{}, true)
+		return ictx
+	}
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func isReadYourWrites(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	flag, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return flag
+}
+
+// replica a read replica and its health
+type replica struct {
+	db      *TracedDB
+	healthy atomic.Bool
+}
+
+// RoutedDB routes reads to read replicas and writes and transactions to the
+// primary, unhealthy replicas are ejected until they pass a health check.
+// Every node is traced under its own service name
+// (<DatabaseServiceName>/primary, <DatabaseServiceName>/replica-<n>) so
+// dependency spans show which node served the query
+type RoutedDB struct {
+	primary  *TracedDB
+	replicas []*replica
+	strategy string
+	next     atomic.Uint64
+
+	stop chan struct{}
+	wg   *sync.WaitGroup
+}
+
+// NewRoutedDatabaseContext creates the primary and replica connections and
+// starts the replica health checks, replicas that can't be reached at startup
+// start out ejected. Every node logs queries slower than the
+// SlowQueryThreshold through lgrf, which may be nil if no threshold is set
+func NewRoutedDatabaseContext(
+	tracer tsqlx.ITracer,
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) (*RoutedDB, error) {
+	switch optn.ReplicaStrategy {
+	case "", ReplicaRoundRobin, ReplicaLeastConnections:
+	default:
+		return nil, fmt.Errorf("unknown replica strategy %s", optn.ReplicaStrategy)
+	}
+
+	popt := *optn
+	popt.DatabaseServiceName = optn.DatabaseServiceName + "/primary"
+	primary, err := NewDatabaseContextWithLogger(tracer, lgrf, &popt)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RoutedDB{
+		primary:  primary,
+		strategy: optn.ReplicaStrategy,
+		stop:     make(chan struct{}),
+		wg:       &sync.WaitGroup{},
+	}
+	for i, conn := range optn.ReadReplicas {
+		ropt := *optn
+		ropt.ConnectionString = conn
+		db, err := openDatabase(lgrf, &ropt)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		configurePool(db, optn)
+
+		rep := &replica{
+			db: NewTracedDB(
+				db,
+				tracer,
+				fmt.Sprintf("%s/replica-%d", optn.DatabaseServiceName, i),
+			),
+		}
+		rep.healthy.Store(ping(rep.db, optn) == nil)
+		r.replicas = append(r.replicas, rep)
+	}
+
+	interval := optn.ReplicaHealthInterval
+	if interval <= 0 {
+		interval = defaultReplicaHealthInterval
+	}
+	if len(r.replicas) > 0 {
+		r.wg.Add(1)
+		go r.healthCheck(interval, optn)
+	}
+	return r, nil
+}
+
+// Primary the primary node
+func (r *RoutedDB) Primary() *TracedDB {
+	return r.primary
+}
+
+// Reader picks the node to read from, the primary if the context is flagged
+// read your writes or no replica is healthy
+func (r *RoutedDB) Reader(ctx context.Context) *TracedDB {
+	if rep := r.pickReplica(ctx); rep != nil {
+		return rep.db
+	}
+	return r.primary
+}
+
+// Get runs a single row read on a replica
+func (r *RoutedDB) Get(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	rep := r.pickReplica(ctx)
+	if rep == nil {
+		return r.primary.Get(ctx, dest, query, args...)
+	}
+	err := rep.db.Get(ctx, dest, query, args...)
+	r.checkConnErr(rep, err)
+	return err
+}
+
+// Select runs a multi row read on a replica
+func (r *RoutedDB) Select(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	rep := r.pickReplica(ctx)
+	if rep == nil {
+		return r.primary.Select(ctx, dest, query, args...)
+	}
+	err := rep.db.Select(ctx, dest, query, args...)
+	r.checkConnErr(rep, err)
+	return err
+}
+
+// Exec runs a write on the primary
+func (r *RoutedDB) Exec(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) (sql.Result, error) {
+	return r.primary.Exec(ctx, query, args...)
+}
+
+// NamedExec runs a named write on the primary
+func (r *RoutedDB) NamedExec(
+	ctx context.Context,
+	query string,
+	arg interface{},
+) (sql.Result, error) {
+	return r.primary.NamedExec(ctx, query, arg)
+}
+
+// BeginTxx starts a transaction on the primary whose statements pass their
+// context down to the driver
+func (r *RoutedDB) BeginTxx(
+	ctx context.Context,
+	opts *sql.TxOptions,
+) (*TracedTx, error) {
+	return r.primary.BeginTxx(ctx, opts)
+}
+
+// Beginx starts a transaction on the primary
+func (r *RoutedDB) Beginx() (*tsqlx.TracedTx, error) {
+	return r.primary.Beginx()
+}
+
+// MustBegin starts a transaction on the primary, panics on failure
+func (r *RoutedDB) MustBegin() *tsqlx.TracedTx {
+	return r.primary.MustBegin()
+}
+
+// Close stops the health checks and closes every node
+func (r *RoutedDB) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+
+	err := r.primary.Close()
+	for _, rep := range r.replicas {
+		if rerr := rep.db.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Picks a healthy replica according to the strategy, nil if reads should go
+// to the primary
+func (r *RoutedDB) pickReplica(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || isReadYourWrites(ctx) {
+		return nil
+	}
+
+	if r.strategy == ReplicaLeastConnections {
+		var best *replica
+		bestInUse := 0
+		for _, rep := range r.replicas {
+			if !rep.healthy.Load() {
+				continue
+			}
+			inUse := rep.db.Stats().InUse
+			if best == nil || inUse < bestInUse {
+				best, bestInUse = rep, inUse
+			}
+		}
+		return best
+	}
+
+	start := r.next.Add(1)
+	for i := 0; i < len(r.replicas); i++ {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+// Ejects the replica if the error means the connection to it is broken,
+// database/sql retries driver.ErrBadConn itself so the error seen here is
+// usually the dial error or a lost connection
+func (r *RoutedDB) checkConnErr(rep *replica, err error) {
+	if err != nil && pgerr.Is(err, pgerr.ErrConnectionLost) {
+		rep.healthy.Store(false)
+	}
+}
+
+func (r *RoutedDB) healthCheck(interval time.Duration, optn *DatabaseOptions) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			for _, rep := range r.replicas {
+				rep.healthy.Store(ping(rep.db, optn) == nil)
+			}
+		}
+	}
+}
+
+// Pings the node once with the ping timeout
+func ping(db *TracedDB, optn *DatabaseOptions) error {
+	timeout := optn.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,273 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExplainInterval = time.Minute
+	explainTimeout         = 10 * time.Second
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$])-?\d+(?:\.\d+)?`)
+)
+
+// slowQueryLog logs slow statements as they are run by the driver. The
+// entries carry the trace ids of the context the statement was run with,
+// which the psqldb TracedDB and TracedTx pass down to the driver. The
+// statements of the embedded tsqlx types are run without their context and
+// are logged without trace ids
+type slowQueryLog struct {
+	threshold       time.Duration
+	explain         bool
+	explainInterval time.Duration
+	lgrf            logger.IFactory
+	db              *sql.DB
+
+	mtx       *sync.Mutex
+	explained map[string]time.Time
+}
+
+func newSlowQueryLog(
+	lgrf logger.IFactory,
+	optn *DatabaseOptions,
+) *slowQueryLog {
+	interval := optn.SlowQueryExplainInterval
+	if interval <= 0 {
+		interval = defaultExplainInterval
+	}
+	return &slowQueryLog{
+		threshold:       optn.SlowQueryThreshold,
+		explain:         optn.SlowQueryExplain,
+		explainInterval: interval,
+		lgrf:            lgrf,
+		mtx:             &sync.Mutex{},
+		explained:       map[string]time.Time{},
+	}
+}
+
+// Logs the statement if it was slow, called by the driver
+func (sl *slowQueryLog) observe(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+	duration time.Duration,
+) {
+	if duration < sl.threshold ||
+		query == "" ||
+		strings.HasPrefix(query, "EXPLAIN ") {
+		return
+	}
+
+	lgr := sl.lgrf.Create(ctx)
+	fields := []zap.Field{
+		zap.Duration("duration", duration),
+		zap.String("statement", redactStatement(query)),
+		zap.Strings("params", paramTypes(args)),
+	}
+	if !sl.shouldExplain(query) {
+		lgr.Warn("slow query", fields...)
+		return
+	}
+
+	// the driver may reuse the arguments once the statement returns
+	args = append([]driver.NamedValue(nil), args...)
+	go func() {
+		plan, err := sl.explainPlan(query, args)
+		if err != nil {
+			fields = append(fields, zap.NamedError("explainError", err))
+		} else {
+			fields = append(fields, zap.String("plan", plan))
+		}
+		lgr.Warn("slow query", fields...)
+	}()
+}
+
+// Checks if the statement can be explained and hasn't been recently
+func (sl *slowQueryLog) shouldExplain(query string) bool {
+	if !sl.explain || sl.db == nil {
+		return false
+	}
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return false
+	}
+	verb := strings.ToUpper(words[0])
+	switch verb {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+	default:
+		return false
+	}
+
+	key := redactStatement(query)
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	if last, ok := sl.explained[key]; ok && time.Since(last) < sl.explainInterval {
+		return false
+	}
+	sl.explained[key] = time.Now()
+	return true
+}
+
+// Plans the statement with its original parameters, without ANALYZE the
+// statement itself is never run
+func (sl *slowQueryLog) explainPlan(
+	query string,
+	args []driver.NamedValue,
+) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	rows, err := sl.db.QueryContext(ctx, "EXPLAIN "+query, values...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	lines := []string{}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+// Replaces literals in the statement so values aren't logged
+func redactStatement(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "'?'")
+	return numericLiteral.ReplaceAllString(query, "${1}?")
+}
+
+// Describes the parameters by type only
+func paramTypes(args []driver.NamedValue) []string {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		if arg.Value == nil {
+			types[i] = "null"
+		} else {
+			types[i] = fmt.Sprintf("%T", arg.Value)
+		}
+	}
+	return types
+}
+
+// slowQueryConnector wraps the driver connector to time statements
+type slowQueryConnector struct {
+	driver.Connector
+	log *slowQueryLog
+}
+
+func (c *slowQueryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryConn{Conn: conn, log: c.log}, nil
+}
+
+// slowQueryConn times statements and forwards the optional driver
+// interfaces of the wrapped connection
+type slowQueryConn struct {
+	driver.Conn
+	log *slowQueryLog
+}
+
+var (
+	_ driver.QueryerContext     = (*slowQueryConn)(nil)
+	_ driver.ExecerContext      = (*slowQueryConn)(nil)
+	_ driver.ConnPrepareContext = (*slowQueryConn)(nil)
+	_ driver.ConnBeginTx        = (*slowQueryConn)(nil)
+	_ driver.Pinger             = (*slowQueryConn)(nil)
+	_ driver.SessionResetter    = (*slowQueryConn)(nil)
+	_ driver.Validator          = (*slowQueryConn)(nil)
+)
+
+func (c *slowQueryConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	c.log.observe(ctx, query, args, time.Since(start))
+	return rows, err
+}
+
+func (c *slowQueryConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	c.log.observe(ctx, query, args, time.Since(start))
+	return res, err
+}
+
+func (c *slowQueryConn) PrepareContext(
+	ctx context.Context,
+	query string,
+) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *slowQueryConn) BeginTx(
+	ctx context.Context,
+	opts driver.TxOptions,
+) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *slowQueryConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *slowQueryConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *slowQueryConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
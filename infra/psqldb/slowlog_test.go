@@ -0,0 +1,240 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/externals/cntxt"
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observedFactory adds the trace id of the context the same way the lgr
+// factory does
+type observedFactory struct {
+	lgr *zap.Logger
+}
+
+func (f *observedFactory) Create(ctx context.Context) *zap.Logger {
+	ictx, ok := ctx.(cntxt.IContext)
+	if !ok {
+		return f.lgr
+	}
+	_, tid, _, _, _ := ictx.GetTraceInfo()
+	return f.lgr.With(zap.String("tid", tid))
+}
+
+func newObservedSlowQueryLog(
+	threshold time.Duration,
+) (*slowQueryLog, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.DebugLevel)
+	sl := newSlowQueryLog(
+		&observedFactory{lgr: zap.New(core)},
+		&DatabaseOptions{SlowQueryThreshold: threshold},
+	)
+	return sl, logs
+}
+
+func TestRedactStatement(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: ""},
+		{
+			name:  "placeholders kept",
+			query: "SELECT * FROM users WHERE id = $1 AND org = $12",
+			want:  "SELECT * FROM users WHERE id = $1 AND org = $12",
+		},
+		{
+			name:  "string literal",
+			query: "SELECT * FROM users WHERE email = 'alice@example.com'",
+			want:  "SELECT * FROM users WHERE email = '?'",
+		},
+		{
+			name:  "escaped quote",
+			query: "SELECT * FROM users WHERE name = 'O''Brien'",
+			want:  "SELECT * FROM users WHERE name = '?'",
+		},
+		{
+			name:  "numeric literals",
+			query: "SELECT * FROM orders WHERE total > 10.5 AND qty=-3 LIMIT 20",
+			want:  "SELECT * FROM orders WHERE total > ? AND qty=? LIMIT ?",
+		},
+		{
+			name:  "leading number",
+			query: "42",
+			want:  "?",
+		},
+		{
+			name:  "identifiers with digits kept",
+			query: "SELECT col1 FROM table2",
+			want:  "SELECT col1 FROM table2",
+		},
+		{
+			name:  "digits in string literal",
+			query: "UPDATE users SET phone = '555-1234' WHERE id = 7",
+			want:  "UPDATE users SET phone = '?' WHERE id = ?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactStatement(tt.query); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShouldExplain(t *testing.T) {
+	tests := []struct {
+		name    string
+		explain bool
+		query   string
+		want    bool
+	}{
+		{name: "disabled", explain: false, query: "SELECT 1", want: false},
+		{name: "empty", explain: true, query: "", want: false},
+		{name: "whitespace", explain: true, query: " \n\t ", want: false},
+		{name: "select", explain: true, query: "SELECT 1", want: true},
+		{name: "lower case", explain: true, query: "  select 1", want: true},
+		{name: "insert", explain: true, query: "INSERT INTO t VALUES (1)", want: true},
+		{name: "update", explain: true, query: "UPDATE t SET a = 1", want: true},
+		{name: "delete", explain: true, query: "DELETE FROM t", want: true},
+		{name: "cte", explain: true, query: "WITH x AS (SELECT 1) SELECT * FROM x", want: true},
+		{name: "ddl", explain: true, query: "CREATE INDEX i ON t (a)", want: false},
+		{name: "transaction", explain: true, query: "BEGIN", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl, _ := newObservedSlowQueryLog(time.Second)
+			sl.explain = tt.explain
+			sl.db = &sql.DB{}
+			if got := sl.shouldExplain(tt.query); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShouldExplainWithoutDB(t *testing.T) {
+	sl, _ := newObservedSlowQueryLog(time.Second)
+	sl.explain = true
+	if sl.shouldExplain("SELECT 1") {
+		t.Error("expected no plan without a database")
+	}
+}
+
+func TestShouldExplainRateLimit(t *testing.T) {
+	sl, _ := newObservedSlowQueryLog(time.Second)
+	sl.explain = true
+	sl.db = &sql.DB{}
+	sl.explainInterval = time.Hour
+
+	if !sl.shouldExplain("SELECT * FROM t WHERE id = 1") {
+		t.Fatal("expected the first plan to be allowed")
+	}
+	if sl.shouldExplain("SELECT * FROM t WHERE id = 2") {
+		t.Error("expected the same statement with other literals to be limited")
+	}
+	if !sl.shouldExplain("SELECT * FROM u WHERE id = 1") {
+		t.Error("expected other statements to be allowed")
+	}
+
+	sl.explained["SELECT * FROM t WHERE id = ?"] = time.Now().Add(-2 * time.Hour)
+	if !sl.shouldExplain("SELECT * FROM t WHERE id = 3") {
+		t.Error("expected the statement to be allowed after the interval")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		duration time.Duration
+		logged   bool
+	}{
+		{name: "slow", query: "SELECT 1", duration: 2 * time.Second, logged: true},
+		{name: "at threshold", query: "SELECT 1", duration: time.Second, logged: true},
+		{name: "fast", query: "SELECT 1", duration: time.Millisecond, logged: false},
+		{name: "empty statement", query: "", duration: 2 * time.Second, logged: false},
+		{name: "explain", query: "EXPLAIN SELECT 1", duration: 2 * time.Second, logged: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl, logs := newObservedSlowQueryLog(time.Second)
+			sl.observe(context.Background(), tt.query, nil, tt.duration)
+			if got := logs.Len() == 1; got != tt.logged {
+				t.Errorf("expected logged %v, got %d entries", tt.logged, logs.Len())
+			}
+		})
+	}
+}
+
+func TestObserveFields(t *testing.T) {
+	sl, logs := newObservedSlowQueryLog(time.Second)
+	sl.observe(
+		context.Background(),
+		"SELECT * FROM users WHERE email = 'alice@example.com' AND id = $1",
+		[]driver.NamedValue{{Ordinal: 1, Value: int64(7)}, {Ordinal: 2}},
+		2*time.Second,
+	)
+	if logs.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", logs.Len())
+	}
+	fields := logs.All()[0].ContextMap()
+	if fields["statement"] != "SELECT * FROM users WHERE email = '?' AND id = $1" {
+		t.Errorf("unexpected statement %v", fields["statement"])
+	}
+	params, _ := fields["params"].([]interface{})
+	if len(params) != 2 || params[0] != "int64" || params[1] != "null" {
+		t.Errorf("unexpected params %v", fields["params"])
+	}
+	if _, ok := fields["tid"]; ok {
+		t.Error("expected no trace id without a trace context")
+	}
+}
+
+// fakeConn a driver connection whose statements take a fixed time
+type fakeConn struct {
+	driver.Conn
+	delay time.Duration
+}
+
+func (c *fakeConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	time.Sleep(c.delay)
+	return nil, nil
+}
+
+func TestSlowQueryConnTraceIds(t *testing.T) {
+	sl, logs := newObservedSlowQueryLog(time.Millisecond)
+	conn := &slowQueryConn{
+		Conn: &fakeConn{delay: 2 * time.Millisecond},
+		log:  sl,
+	}
+	ctx := tracectx.New(context.Background(), "")
+
+	if _, err := conn.QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", logs.Len())
+	}
+	_, tid, _, _, _ := ctx.GetTraceInfo()
+	if got := logs.All()[0].ContextMap()["tid"]; got != tid {
+		t.Errorf("expected trace id %s, got %v", tid, got)
+	}
+
+	if _, err := conn.ExecContext(ctx, "UPDATE t SET a = 1", nil); err != driver.ErrSkip {
+		t.Errorf("expected ErrSkip for unsupported interfaces, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package psqldb
+
+import "strings"
+
+// splitStatements splits a script into its statements on the semicolons
+// that aren't inside of quotes, comments or dollar quoted bodies, empty
+// statements are dropped. Postgres runs a multi statement query in an
+// implicit transaction, so NoTransaction scripts are run one statement at a
+// time
+func splitStatements(script string) []string {
+	stmts := []string{}
+	start := 0
+	add := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); !isBlank(stmt) {
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == ';':
+			add(i)
+		case c == '\'':
+			escapes := i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') &&
+				(i < 2 || !isIdentChar(script[i-2]))
+			i = skipQuoted(script, i, '\'', escapes)
+		case c == '"':
+			i = skipQuoted(script, i, '"', false)
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			i = skipBlockComment(script, i)
+		case c == '$' && (i == 0 || !isIdentChar(script[i-1])):
+			i = skipDollarQuoted(script, i)
+		}
+	}
+	add(len(script))
+	return stmts
+}
+
+// Returns the index of the closing quote, doubled quotes and (for escape
+// strings) backslashes escape the quote
+func skipQuoted(script string, i int, quote byte, escapes bool) int {
+	for i++; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(script) && script[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(script)
+}
+
+// Returns the index of the end of the block comment, block comments nest
+func skipBlockComment(script string, i int) int {
+	depth := 0
+	for ; i < len(script); i++ {
+		switch {
+		case strings.HasPrefix(script[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(script[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(script)
+}
+
+// Returns the index of the end of the closing tag if the dollar sign starts a
+// dollar quote ($$ or $tag$), positional parameters such as $1 are skipped
+func skipDollarQuoted(script string, i int) int {
+	end := i + 1
+	for end < len(script) && isIdentChar(script[end]) {
+		end++
+	}
+	if end >= len(script) || script[end] != '$' ||
+		(end > i+1 && script[i+1] >= '0' && script[i+1] <= '9') {
+		return i
+	}
+
+	tag := script[i : end+1]
+	idx := strings.Index(script[end+1:], tag)
+	if idx < 0 {
+		return len(script)
+	}
+	return end + idx + len(tag)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+// Checks if the statement only holds comments and whitespace
+func isBlank(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
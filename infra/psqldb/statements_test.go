@@ -0,0 +1,100 @@
+package psqldb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "empty", script: "", want: []string{}},
+		{name: "whitespace", script: " \n\t", want: []string{}},
+		{
+			name:   "single without semicolon",
+			script: "CREATE INDEX CONCURRENTLY i ON t (a)",
+			want:   []string{"CREATE INDEX CONCURRENTLY i ON t (a)"},
+		},
+		{
+			name: "concurrent indexes",
+			script: `-- psqldb:no-transaction
+				CREATE INDEX CONCURRENTLY IF NOT EXISTS users_email ON users (email);
+				CREATE INDEX CONCURRENTLY IF NOT EXISTS users_name ON users (name);
+			`,
+			want: []string{
+				"-- psqldb:no-transaction\n\t\t\t\tCREATE INDEX CONCURRENTLY IF NOT EXISTS users_email ON users (email)",
+				"CREATE INDEX CONCURRENTLY IF NOT EXISTS users_name ON users (name)",
+			},
+		},
+		{
+			name:   "empty statements",
+			script: "SELECT 1;; ;SELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "trailing comment",
+			script: "SELECT 1;\n-- done\n",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "string literal",
+			script: "INSERT INTO t VALUES ('a;b', 'it''s;');SELECT 1",
+			want:   []string{"INSERT INTO t VALUES ('a;b', 'it''s;')", "SELECT 1"},
+		},
+		{
+			name:   "escape string",
+			script: `INSERT INTO t VALUES (E'a\';b');SELECT 1`,
+			want:   []string{`INSERT INTO t VALUES (E'a\';b')`, "SELECT 1"},
+		},
+		{
+			name:   "backslash in standard string",
+			script: `INSERT INTO t VALUES ('a\');SELECT 1`,
+			want:   []string{`INSERT INTO t VALUES ('a\')`, "SELECT 1"},
+		},
+		{
+			name:   "quoted identifier",
+			script: `CREATE TABLE "a;b" (x int);SELECT 1`,
+			want:   []string{`CREATE TABLE "a;b" (x int)`, "SELECT 1"},
+		},
+		{
+			name:   "line comment",
+			script: "SELECT 1 -- a;b\n;SELECT 2",
+			want:   []string{"SELECT 1 -- a;b", "SELECT 2"},
+		},
+		{
+			name:   "nested block comment",
+			script: "SELECT 1 /* a; /* b; */ c; */;SELECT 2",
+			want:   []string{"SELECT 1 /* a; /* b; */ c; */", "SELECT 2"},
+		},
+		{
+			name: "dollar quoted body",
+			script: `CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;
+				ALTER TYPE mood ADD VALUE 'ok'`,
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql",
+				"ALTER TYPE mood ADD VALUE 'ok'",
+			},
+		},
+		{
+			name:   "tagged dollar quote",
+			script: "SELECT $fn$ a; $$ b; $fn$;SELECT 2",
+			want:   []string{"SELECT $fn$ a; $$ b; $fn$", "SELECT 2"},
+		},
+		{
+			name:   "positional parameters",
+			script: "UPDATE t SET a = $1;SELECT $2",
+			want:   []string{"UPDATE t SET a = $1", "SELECT $2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package psqldb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BetaLixT/tsqlx"
+	"go.uber.org/zap"
+)
+
+// States of a migration reported by Status
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified"
+	MigrationUnknown  = "unknown"
+)
+
+// MigrationStatus state of a single migration, migrations that are recorded
+// as applied but aren't part of the provided migrations are unknown
+type MigrationStatus struct {
+	Key             string
+	State           string
+	AppliedAt       *time.Time
+	Checksum        string
+	AppliedChecksum string
+}
+
+// Status reports the state of each of the migrations in order followed by any
+// unknown applied migrations, nothing is changed
+func Status(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) ([]MigrationStatus, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exMigrs, err := fetchMigrationHistory(ctx, tx, opts)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]migrationEntity, len(exMigrs))
+	for _, e := range exMigrs {
+		applied[e.Key] = e
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	known := make(map[string]struct{}, len(migrations))
+	for _, migr := range migrations {
+		known[migr.Key] = struct{}{}
+		st := MigrationStatus{
+			Key:      migr.Key,
+			State:    MigrationPending,
+			Checksum: migr.Checksum(),
+		}
+		if e, ok := applied[migr.Key]; ok {
+			st.State = MigrationApplied
+			st.AppliedAt = e.DateTimeCreated
+			if e.Checksum != nil {
+				st.AppliedChecksum = *e.Checksum
+				if st.AppliedChecksum != st.Checksum {
+					st.State = MigrationModified
+				}
+			}
+		}
+		status = append(status, st)
+	}
+	for _, e := range exMigrs {
+		if _, ok := known[e.Key]; ok {
+			continue
+		}
+		st := MigrationStatus{
+			Key:       e.Key,
+			State:     MigrationUnknown,
+			AppliedAt: e.DateTimeCreated,
+		}
+		if e.Checksum != nil {
+			st.AppliedChecksum = *e.Checksum
+		}
+		status = append(status, st)
+	}
+	return status, nil
+}
+
+// PlanMigrations returns the keys of the migrations RunMigrations would apply
+// without changing anything
+func PlanMigrations(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	opts *MigrationOptions,
+) ([]string, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exMigrs, err := fetchMigrationHistory(ctx, tx, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for idx, migr := range migrations {
+		if idx < len(exMigrs) {
+			if migr.Key != exMigrs[idx].Key {
+				return nil, &ErrKeyMismatch{
+					Index:    idx,
+					Expected: migr.Key,
+					Actual:   exMigrs[idx].Key,
+				}
+			}
+			continue
+		}
+		keys = append(keys, migr.Key)
+	}
+	return keys, nil
+}
+
+// BaselineMigrations records the migrations up to and including targetKey as
+// applied without running them, for databases whose schema was created before
+// migrations were tracked. An empty targetKey baselines every migration
+func BaselineMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) error {
+	return opts.withLock(ctx, lgr, db, func() error {
+		return baselineMigrations(ctx, lgr, db, migrations, targetKey, opts)
+	})
+}
+
+func baselineMigrations(
+	ctx context.Context,
+	lgr *zap.Logger,
+	db *tsqlx.TracedDB,
+	migrations []MigrationScript,
+	targetKey string,
+	opts *MigrationOptions,
+) (err error) {
+	target := len(migrations) - 1
+	if targetKey != "" {
+		target = -1
+		for idx := range migrations {
+			if migrations[idx].Key == targetKey {
+				target = idx
+				break
+			}
+		}
+		if target == -1 {
+			return fmt.Errorf("%w: %s", ErrUnknownMigration, targetKey)
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = ensureMigrationTable(ctx, lgr, tx, opts); err != nil {
+		return err
+	}
+	exMigrs, err := fetchMigrationHistory(ctx, tx, opts)
+	if err != nil {
+		return err
+	}
+
+	for idx := 0; idx <= target; idx++ {
+		migr := migrations[idx]
+		if idx < len(exMigrs) {
+			if migr.Key != exMigrs[idx].Key {
+				return &ErrKeyMismatch{
+					Index:    idx,
+					Expected: migr.Key,
+					Actual:   exMigrs[idx].Key,
+				}
+			}
+			continue
+		}
+		lgr.Info("Baselining migration", zap.String("migration", migr.Key))
+		_, err = tx.ExecContext(
+			ctx,
+			opts.query(addMigration),
+			migr.Key,
+			migr.Checksum(),
+		)
+		if err != nil {
+			return &ErrMigrationFailed{Key: migr.Key, Err: err}
+		}
+	}
+	return tx.Commit()
+}
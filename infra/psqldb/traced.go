@@ -0,0 +1,210 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/BetaLixT/tsqlx"
+	"github.com/jmoiron/sqlx"
+)
+
+// TracedDB a tsqlx.TracedDB whose statements pass their context down to the
+// driver, so they're cancelled with the context and slow queries are logged
+// with its trace ids. The embedded tsqlx.TracedDB can be passed to code that
+// expects one but its statements don't carry the context
+type TracedDB struct {
+	*tsqlx.TracedDB
+	tracer      tsqlx.ITracer
+	serviceName string
+}
+
+// NewTracedDB wraps the database, statements are traced as dependencies of
+// the service
+func NewTracedDB(
+	db *sqlx.DB,
+	tracer tsqlx.ITracer,
+	serviceName string,
+) *TracedDB {
+	return &TracedDB{
+		TracedDB:    tsqlx.NewTracedDB(db, tracer, serviceName),
+		tracer:      tracer,
+		serviceName: serviceName,
+	}
+}
+
+func (db *TracedDB) Get(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	start := time.Now()
+	err := db.DB.GetContext(ctx, dest, query, args...)
+	db.trace(ctx, "Get", query, start, err)
+	return err
+}
+
+func (db *TracedDB) Select(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	start := time.Now()
+	err := db.DB.SelectContext(ctx, dest, query, args...)
+	db.trace(ctx, "Select", query, start, err)
+	return err
+}
+
+func (db *TracedDB) Exec(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	db.trace(ctx, "Exec", query, start, err)
+	return res, err
+}
+
+func (db *TracedDB) NamedExec(
+	ctx context.Context,
+	query string,
+	arg interface{},
+) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.NamedExecContext(ctx, query, arg)
+	db.trace(ctx, "NamedExec", query, start, err)
+	return res, err
+}
+
+// BeginTxx starts a transaction whose statements pass their context down to
+// the driver, the transaction is rolled back if ctx is done before it's
+// committed
+func (db *TracedDB) BeginTxx(
+	ctx context.Context,
+	opts *sql.TxOptions,
+) (*TracedTx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TracedTx{
+		Tx:          tx,
+		tracer:      db.tracer,
+		serviceName: db.serviceName,
+	}, nil
+}
+
+func (db *TracedDB) trace(
+	ctx context.Context,
+	command string,
+	query string,
+	start time.Time,
+	err error,
+) {
+	traceStatement(
+		ctx, db.tracer, db.DriverName(), db.serviceName,
+		command, query, start, err,
+	)
+}
+
+// TracedTx a transaction whose statements pass their context down to the
+// driver, started with TracedDB.BeginTxx
+type TracedTx struct {
+	*sqlx.Tx
+	tracer      tsqlx.ITracer
+	serviceName string
+}
+
+func (tx *TracedTx) Get(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	start := time.Now()
+	err := tx.Tx.GetContext(ctx, dest, query, args...)
+	tx.trace(ctx, "Get", query, start, err)
+	return err
+}
+
+func (tx *TracedTx) Select(
+	ctx context.Context,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	start := time.Now()
+	err := tx.Tx.SelectContext(ctx, dest, query, args...)
+	tx.trace(ctx, "Select", query, start, err)
+	return err
+}
+
+func (tx *TracedTx) Exec(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) (sql.Result, error) {
+	start := time.Now()
+	res, err := tx.Tx.ExecContext(ctx, query, args...)
+	tx.trace(ctx, "Exec", query, start, err)
+	return res, err
+}
+
+func (tx *TracedTx) NamedExec(
+	ctx context.Context,
+	query string,
+	arg interface{},
+) (sql.Result, error) {
+	start := time.Now()
+	res, err := tx.Tx.NamedExecContext(ctx, query, arg)
+	tx.trace(ctx, "NamedExec", query, start, err)
+	return res, err
+}
+
+func (tx *TracedTx) trace(
+	ctx context.Context,
+	command string,
+	query string,
+	start time.Time,
+	err error,
+) {
+	traceStatement(
+		ctx, tx.tracer, tx.DriverName(), tx.serviceName,
+		command, query, start, err,
+	)
+}
+
+// Traces the statement as a dependency, the query is only attached to failed
+// statements the same way tsqlx does
+func traceStatement(
+	ctx context.Context,
+	tracer tsqlx.ITracer,
+	driverName string,
+	serviceName string,
+	command string,
+	query string,
+	start time.Time,
+	err error,
+) {
+	var fields map[string]string
+	if err != nil {
+		fields = map[string]string{
+			"error": err.Error(),
+			"query": query,
+		}
+	}
+	tracer.TraceDependency(
+		ctx,
+		"",
+		driverName,
+		serviceName,
+		command,
+		err == nil,
+		start,
+		time.Now(),
+		fields,
+	)
+}
@@ -0,0 +1,269 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb/internal/tracectx"
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtConn a driver connection whose statements take a fixed time unless
+// their context is done first
+type stmtConn struct {
+	delay time.Duration
+}
+
+func (c *stmtConn) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.delay):
+		return nil
+	}
+}
+
+func (c *stmtConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &oneRow{}, nil
+}
+
+func (c *stmtConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *stmtConn) BeginTx(
+	ctx context.Context,
+	opts driver.TxOptions,
+) (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *stmtConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *stmtConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *stmtConn) Close() error              { return nil }
+func (c *stmtConn) Commit() error             { return nil }
+func (c *stmtConn) Rollback() error           { return nil }
+
+// oneRow rows with a single row holding 1
+type oneRow struct {
+	done bool
+}
+
+func (r *oneRow) Columns() []string { return []string{"n"} }
+func (r *oneRow) Close() error      { return nil }
+
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type stmtConnector struct {
+	conn *stmtConn
+}
+
+func (c *stmtConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c *stmtConnector) Driver() driver.Driver { return nil }
+
+// recordingTracer keeps the commands of the traced dependencies
+type recordingTracer struct {
+	commands []string
+	success  []bool
+}
+
+func (t *recordingTracer) TraceDependency(
+	ctx context.Context,
+	spanId string,
+	dependencyType string,
+	serviceName string,
+	commandName string,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) {
+	t.commands = append(t.commands, commandName)
+	t.success = append(t.success, success)
+}
+
+func newStmtTracedDB(
+	delay time.Duration,
+	threshold time.Duration,
+) (*TracedDB, *recordingTracer, func() []string) {
+	sl, logs := newObservedSlowQueryLog(threshold)
+	sdb := sql.OpenDB(&slowQueryConnector{
+		Connector: &stmtConnector{conn: &stmtConn{delay: delay}},
+		log:       sl,
+	})
+	tracer := &recordingTracer{}
+	db := NewTracedDB(sqlx.NewDb(sdb, "postgres"), tracer, "test")
+	tids := func() []string {
+		ids := []string{}
+		for _, entry := range logs.All() {
+			tid, _ := entry.ContextMap()["tid"].(string)
+			ids = append(ids, tid)
+		}
+		return ids
+	}
+	return db, tracer, tids
+}
+
+func TestTracedDBPassesContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		run     func(ctx context.Context, db *TracedDB) error
+	}{
+		{
+			name:    "get",
+			command: "Get",
+			run: func(ctx context.Context, db *TracedDB) error {
+				n := 0
+				return db.Get(ctx, &n, "SELECT 1")
+			},
+		},
+		{
+			name:    "select",
+			command: "Select",
+			run: func(ctx context.Context, db *TracedDB) error {
+				n := []int{}
+				return db.Select(ctx, &n, "SELECT 1")
+			},
+		},
+		{
+			name:    "exec",
+			command: "Exec",
+			run: func(ctx context.Context, db *TracedDB) error {
+				_, err := db.Exec(ctx, "UPDATE t SET a = 1")
+				return err
+			},
+		},
+		{
+			name:    "transaction",
+			command: "Exec",
+			run: func(ctx context.Context, db *TracedDB) error {
+				tx, err := db.BeginTxx(ctx, nil)
+				if err != nil {
+					return err
+				}
+				if _, err = tx.Exec(ctx, "UPDATE t SET a = 1"); err != nil {
+					tx.Rollback()
+					return err
+				}
+				return tx.Commit()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, tracer, tids := newStmtTracedDB(2*time.Millisecond, time.Millisecond)
+			defer db.Close()
+			ctx := tracectx.New(context.Background(), "")
+
+			if err := tt.run(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+
+			_, tid, _, _, _ := ctx.GetTraceInfo()
+			got := tids()
+			if len(got) != 1 || got[0] != tid {
+				t.Errorf("expected a slow query entry with trace id %s, got %v", tid, got)
+			}
+			if len(tracer.commands) != 1 ||
+				tracer.commands[0] != tt.command ||
+				!tracer.success[0] {
+				t.Errorf("unexpected traced dependencies %v", tracer.commands)
+			}
+		})
+	}
+}
+
+func TestTracedDBCancel(t *testing.T) {
+	db, tracer, _ := newStmtTracedDB(time.Minute, time.Hour)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := db.Exec(ctx, "UPDATE t SET a = 1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the statement to be cancelled, got %v", err)
+	}
+	if len(tracer.success) != 1 || tracer.success[0] {
+		t.Error("expected a failed dependency to be traced")
+	}
+}
+
+func TestSlowQueryRequiresLogger(t *testing.T) {
+	optn := &DatabaseOptions{
+		ConnectionString:   "postgres://localhost/test?connect_timeout=1",
+		SlowQueryThreshold: time.Second,
+	}
+	tests := []struct {
+		name string
+		open func() error
+	}{
+		{
+			name: "database context",
+			open: func() error {
+				_, err := NewDatabaseContext(&recordingTracer{}, optn)
+				return err
+			},
+		},
+		{
+			name: "without logger",
+			open: func() error {
+				_, err := NewDatabaseContextWithLogger(&recordingTracer{}, nil, optn)
+				return err
+			},
+		},
+		{
+			name: "cleanup",
+			open: func() error {
+				_, _, err := NewDatabaseContextWithCleanup(&recordingTracer{}, nil, optn)
+				return err
+			},
+		},
+		{
+			name: "routed",
+			open: func() error {
+				_, err := NewRoutedDatabaseContext(&recordingTracer{}, nil, optn)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.open(); !errors.Is(err, ErrSlowQueryLogger) {
+				t.Errorf("expected ErrSlowQueryLogger, got %v", err)
+			}
+		})
+	}
+}
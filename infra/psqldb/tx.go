@@ -0,0 +1,234 @@
+package psqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BetaLixT/gowebstd/infra/psqldb/pgerr"
+	"github.com/BetaLixT/tsqlx"
+)
+
+const (
+	defaultTxRetries      = 3
+	defaultTxRetryBackoff = 50 * time.Millisecond
+	cancelTimeout         = 5 * time.Second
+)
+
+const (
+	BackendPid = `
+		SELECT pg_backend_pid()`
+	CancelBackend = `
+		SELECT pg_cancel_backend($1)`
+)
+
+// TxOptions options for WithTx
+type TxOptions struct {
+	// Isolation isolation level of the transaction, sql.LevelDefault keeps
+	// the server default
+	Isolation sql.IsolationLevel
+	// ReadOnly starts a read only transaction
+	ReadOnly bool
+	// MaxRetries retries after serialization failures and deadlocks,
+	// defaults to 3, negative disables retries
+	MaxRetries int
+	// RetryBackoff initial delay between retries, doubled on every retry
+	// with jitter, defaults to 50 milliseconds
+	RetryBackoff time.Duration
+	// Tracer if set a dependency span is traced for the transaction
+	// recording the number of attempts
+	Tracer tsqlx.ITracer
+	// ServiceName of the database for the transaction span
+	ServiceName string
+}
+
+// WithTx runs fn in a transaction, committing if fn succeeds and rolling back
+// if it fails or panics. The whole transaction is retried with backoff if it
+// fails with a serialization failure or deadlock, so fn must be safe to run
+// more than once. tsqlx doesn't pass the context of its statements to the
+// driver, so if ctx can be cancelled the backend of the transaction is looked
+// up and once ctx is done the running statement is cancelled on the server
+// and the transaction rolled back
+func WithTx(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	opts *TxOptions,
+	fn func(tx *tsqlx.TracedTx) error,
+) (err error) {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+	delay := opts.RetryBackoff
+	if delay <= 0 {
+		delay = defaultTxRetryBackoff
+	}
+
+	start := time.Now()
+	attempt := 0
+	defer func() {
+		if opts.Tracer == nil {
+			return
+		}
+		fields := map[string]string{
+			"attempts": strconv.Itoa(attempt + 1),
+			"retries":  strconv.Itoa(attempt),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		opts.Tracer.TraceDependency(
+			ctx,
+			"",
+			db.DriverName(),
+			opts.ServiceName,
+			"Transaction",
+			err == nil,
+			start,
+			time.Now(),
+			fields,
+		)
+	}()
+
+	for ; ; attempt++ {
+		err = runTx(ctx, db, opts, fn)
+		if err == nil || attempt >= retries || !pgerr.IsRetryable(err) {
+			return err
+		}
+
+		// jitter keeps conflicting transactions from retrying in lockstep
+		wait := delay + time.Duration(rand.Int63n(int64(delay)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// Runs a single attempt of the transaction
+func runTx(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	opts *TxOptions,
+	fn func(tx *tsqlx.TracedTx) error,
+) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	stop := func() {}
+	defer func() {
+		stop()
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = setTxCharacteristics(ctx, tx, opts); err != nil {
+		return err
+	}
+	if stop, err = cancelOnDone(ctx, db, tx); err != nil {
+		return err
+	}
+	err = fn(tx)
+	stop()
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cancels the statement running in the transaction and rolls it back once ctx
+// is done, the returned function stops watching and waits for a cancel that
+// is in progress so it can't hit statements run after it returns
+func cancelOnDone(
+	ctx context.Context,
+	db *tsqlx.TracedDB,
+	tx *tsqlx.TracedTx,
+) (func(), error) {
+	if ctx.Done() == nil {
+		return func() {}, nil
+	}
+	pid := 0
+	if err := tx.Tx.GetContext(ctx, &pid, BackendPid); err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-stop:
+		case <-ctx.Done():
+			cctx, cancel := context.WithTimeout(
+				context.Background(),
+				cancelTimeout,
+			)
+			defer cancel()
+			db.DB.ExecContext(cctx, CancelBackend, pid)
+			tx.Rollback()
+		}
+	}()
+
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}, nil
+}
+
+// Sets the isolation level and access mode, must be the first statement of
+// the transaction
+func setTxCharacteristics(
+	ctx context.Context,
+	tx *tsqlx.TracedTx,
+	opts *TxOptions,
+) error {
+	stmt := ""
+	switch opts.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		stmt = "ISOLATION LEVEL READ UNCOMMITTED"
+	case sql.LevelReadCommitted:
+		stmt = "ISOLATION LEVEL READ COMMITTED"
+	case sql.LevelRepeatableRead:
+		stmt = "ISOLATION LEVEL REPEATABLE READ"
+	case sql.LevelSerializable:
+		stmt = "ISOLATION LEVEL SERIALIZABLE"
+	default:
+		return fmt.Errorf("unsupported isolation level %s", opts.Isolation)
+	}
+	if opts.ReadOnly {
+		if stmt != "" {
+			stmt += ", "
+		}
+		stmt += "READ ONLY"
+	}
+	if stmt == "" {
+		return nil
+	}
+	_, err := tx.Tx.ExecContext(ctx, "SET TRANSACTION "+stmt)
+	return err
+}
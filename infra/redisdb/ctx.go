@@ -4,7 +4,6 @@ package redisdb
 
 import (
 	"context"
-	"crypto/tls"
 
 	"github.com/BetaLixT/gotred/v8"
 	"github.com/go-redis/redis/v8"
@@ -15,31 +14,123 @@ func NewRedisContext(
 	optn *Options,
 	tracer gotred.ITracer,
 ) (*redis.Client, error) {
+	tlsCfg, err := optn.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
 	rop := &redis.Options{
 		Addr:     optn.Address,
+		Username: optn.Username,
 		Password: optn.Password, // no password set
 		DB:       optn.Database, // use default DB
-	}
-	if optn.TLS {
-		rop.TLSConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			// Certificates: []tls.Certificate{cert}
-		}
+
+		PoolSize:        optn.PoolSize,
+		MinIdleConns:    optn.MinIdleConns,
+		PoolTimeout:     optn.PoolTimeout,
+		DialTimeout:     optn.DialTimeout,
+		ReadTimeout:     optn.ReadTimeout,
+		WriteTimeout:    optn.WriteTimeout,
+		MaxRetries:      optn.MaxRetries,
+		MinRetryBackoff: optn.MinRetryBackoff,
+		MaxRetryBackoff: optn.MaxRetryBackoff,
+		TLSConfig:       tlsCfg,
 	}
 	client := redis.NewClient(
 		rop,
 	)
-	ctx := context.Background()
-	status := client.Ping(ctx)
-	err := status.Err()
+	if err := ping(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	client.AddHook(newTraceHook(optn, tracer))
+	return client, nil
+}
+
+// NewFailoverRedisContext constructs a redis client that discovers the
+// master through redis sentinel and follows it on failover
+func NewFailoverRedisContext(
+	optn *Options,
+	tracer gotred.ITracer,
+) (*redis.Client, error) {
+	tlsCfg, err := optn.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
-	traceHook := gotred.NewTraceHook(
+	fop := &redis.FailoverOptions{
+		MasterName:       optn.MasterName,
+		SentinelAddrs:    optn.SentinelAddresses,
+		SentinelUsername: optn.SentinelUsername,
+		SentinelPassword: optn.SentinelPassword,
+		Username:         optn.Username,
+		Password:         optn.Password,
+		DB:               optn.Database,
+
+		PoolSize:        optn.PoolSize,
+		MinIdleConns:    optn.MinIdleConns,
+		PoolTimeout:     optn.PoolTimeout,
+		DialTimeout:     optn.DialTimeout,
+		ReadTimeout:     optn.ReadTimeout,
+		WriteTimeout:    optn.WriteTimeout,
+		MaxRetries:      optn.MaxRetries,
+		MinRetryBackoff: optn.MinRetryBackoff,
+		MaxRetryBackoff: optn.MaxRetryBackoff,
+		TLSConfig:       tlsCfg,
+	}
+	client := redis.NewFailoverClient(fop)
+	if err := ping(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	client.AddHook(newTraceHook(optn, tracer))
+	return client, nil
+}
+
+// NewClusterRedisContext constructs a redis cluster client
+func NewClusterRedisContext(
+	optn *Options,
+	tracer gotred.ITracer,
+) (*redis.ClusterClient, error) {
+	tlsCfg, err := optn.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	cop := &redis.ClusterOptions{
+		Addrs:          optn.ClusterAddresses,
+		Username:       optn.Username,
+		Password:       optn.Password,
+		ReadOnly:       optn.ReadOnly,
+		RouteByLatency: optn.RouteByLatency,
+
+		PoolSize:        optn.PoolSize,
+		MinIdleConns:    optn.MinIdleConns,
+		PoolTimeout:     optn.PoolTimeout,
+		DialTimeout:     optn.DialTimeout,
+		ReadTimeout:     optn.ReadTimeout,
+		WriteTimeout:    optn.WriteTimeout,
+		MaxRetries:      optn.MaxRetries,
+		MinRetryBackoff: optn.MinRetryBackoff,
+		MaxRetryBackoff: optn.MaxRetryBackoff,
+		TLSConfig:       tlsCfg,
+	}
+	client := redis.NewClusterClient(cop)
+	if err := ping(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	client.AddHook(newTraceHook(optn, tracer))
+	return client, nil
+}
+
+func ping(client redis.UniversalClient) error {
+	return client.Ping(context.Background()).Err()
+}
+
+func newTraceHook(optn *Options, tracer gotred.ITracer) *gotred.TraceHook {
+	return gotred.NewTraceHook(
 		tracer,
 		optn.ServiceName,
 	)
-
-	client.AddHook(traceHook)
-	return client, nil
 }
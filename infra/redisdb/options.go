@@ -1,5 +1,7 @@
 package redisdb
 
+import "time"
+
 // Options provide options for the redis client
 type Options struct {
 	Address     string
@@ -7,4 +9,65 @@ type Options struct {
 	ServiceName string
 	TLS         bool
 	Database    int
+
+	// Username ACL user, requires redis 6 or later
+	Username string
+
+	// PoolSize maximum connections per node, 0 keeps the go-redis default of
+	// 10 per CPU
+	PoolSize int
+	// MinIdleConns idle connections kept open per node
+	MinIdleConns int
+	// PoolTimeout time to wait for a free connection, 0 keeps the go-redis
+	// default of ReadTimeout + 1 second
+	PoolTimeout time.Duration
+
+	// DialTimeout timeout for establishing connections, 0 keeps the go-redis
+	// default of 5 seconds
+	DialTimeout time.Duration
+	// ReadTimeout timeout for reads, 0 keeps the go-redis default of
+	// 3 seconds and -1 disables it
+	ReadTimeout time.Duration
+	// WriteTimeout timeout for writes, 0 defaults to ReadTimeout
+	WriteTimeout time.Duration
+
+	// MaxRetries retries of failed commands, 0 keeps the go-redis default of
+	// 3 and -1 disables retries
+	MaxRetries int
+	// MinRetryBackoff initial delay between retries, 0 keeps the go-redis
+	// default of 8 milliseconds and -1 disables backoff
+	MinRetryBackoff time.Duration
+	// MaxRetryBackoff upper bound of the retry delay, 0 keeps the go-redis
+	// default of 512 milliseconds and -1 disables backoff
+	MaxRetryBackoff time.Duration
+
+	// TLSCAFile PEM file of the certificate authorities the server
+	// certificate is verified against, the system pool is used if empty
+	TLSCAFile string
+	// TLSCertFile PEM file of the client certificate, requires TLSKeyFile
+	TLSCertFile string
+	// TLSKeyFile PEM file of the client certificate key
+	TLSKeyFile string
+	// TLSServerName name the server certificate is verified against,
+	// defaults to the host of the address
+	TLSServerName string
+
+	// MasterName name of the master monitored by the sentinels, used by
+	// NewFailoverRedisContext
+	MasterName string
+	// SentinelAddresses addresses of the sentinels
+	SentinelAddresses []string
+	// SentinelUsername ACL user of the sentinels
+	SentinelUsername string
+	// SentinelPassword password of the sentinels
+	SentinelPassword string
+
+	// ClusterAddresses seed addresses of the cluster nodes, used by
+	// NewClusterRedisContext
+	ClusterAddresses []string
+	// ReadOnly routes read commands to replica nodes of the cluster
+	ReadOnly bool
+	// RouteByLatency routes read commands to the closest node of the
+	// cluster, implies ReadOnly
+	RouteByLatency bool
 }
@@ -0,0 +1,56 @@
+package redisdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrInvalidCAFile        = errors.New("no certificates found in tls ca file")
+	ErrIncompleteTLSKeyPair = errors.New(
+		"tls cert file and key file must be set together",
+	)
+)
+
+// Builds the tls config of the options, nil if tls isn't enabled. Setting
+// any of the certificate files enables tls
+func (optn *Options) tlsConfig() (*tls.Config, error) {
+	if !optn.TLS &&
+		optn.TLSCAFile == "" &&
+		optn.TLSCertFile == "" &&
+		optn.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: optn.TLSServerName,
+	}
+
+	if optn.TLSCAFile != "" {
+		pem, err := os.ReadFile(optn.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidCAFile
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (optn.TLSCertFile == "") != (optn.TLSKeyFile == "") {
+		return nil, ErrIncompleteTLSKeyPair
+	}
+	if optn.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(optn.TLSCertFile, optn.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading tls key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
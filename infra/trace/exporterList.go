@@ -9,6 +9,7 @@ import (
 	"github.com/BetaLixT/gowebstd/infra/trace/logex"
 	"github.com/BetaLixT/gowebstd/infra/trace/promex"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
 )
 
 // NewTraceExporterList provides a list of exporters for tracing
@@ -20,24 +21,76 @@ func NewTraceExporterList(
 	lgrf logger.IFactory,
 ) *ExporterList {
 	lgr := lgrf.Create(context.Background())
+	exp, _ := collectExporters(insexp, jgrexp, lgexp, prmex, lgr)
+	return &ExporterList{
+		Exporters: exp,
+	}
+}
+
+// NewIsolatedTraceExporterList provides a list of exporters for tracing
+// where every exporter is isolated with its own queue, timeout, retries and
+// circuit breaker as configured by the Isolation options, the exporters are
+// used as is if Isolation is not set
+func NewIsolatedTraceExporterList(
+	insexp appinsights.TraceExporter,
+	jgrexp jaeger.TraceExporter,
+	lgexp logex.TraceExporter,
+	prmex promex.TraceExporter,
+	opts *Options,
+	lgrf logger.IFactory,
+) *ExporterList {
+	lgr := lgrf.Create(context.Background())
+	exp, names := collectExporters(insexp, jgrexp, lgexp, prmex, lgr)
+
+	if opts == nil || opts.Isolation == nil {
+		return &ExporterList{
+			Exporters: exp,
+		}
+	}
+
+	iopts := opts.Isolation.withDefaults()
+	metrics := newExporterMetrics(iopts.MetricsPrefix)
+	isolated := make([]*IsolatedExporter, len(exp))
+	for i := range exp {
+		isolated[i] = newIsolatedExporter(names[i], exp[i], iopts, metrics, lgr)
+		exp[i] = isolated[i]
+	}
+	return &ExporterList{
+		Exporters: exp,
+		isolated:  isolated,
+	}
+}
+
+// Picks the available exporters along with their names, the console
+// exporter is used if neither insights nor jaeger are available
+func collectExporters(
+	insexp appinsights.TraceExporter,
+	jgrexp jaeger.TraceExporter,
+	lgexp logex.TraceExporter,
+	prmex promex.TraceExporter,
+	lgr *zap.Logger,
+) ([]sdktrace.SpanExporter, []string) {
 	exp := []sdktrace.SpanExporter{}
+	names := []string{}
 
 	if insexp != nil {
 		exp = append(exp, insexp)
+		names = append(names, "appinsights")
 	} else {
 		lgr.Warn("insights exporter not found")
 	}
 	if jgrexp != nil {
 		exp = append(exp, jgrexp)
+		names = append(names, "jaeger")
 	} else {
 		lgr.Warn("jeager exporter not found")
 	}
 	if len(exp) == 0 {
 		lgr.Warn("not tracing exporters found, console trace exporter will be used")
 		exp = append(exp, lgexp)
+		names = append(names, "logex")
 	}
 	exp = append(exp, prmex)
-	return &ExporterList{
-		Exporters: exp,
-	}
+	names = append(names, "promex")
+	return exp, names
 }
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/BetaLixT/gowebstd v0.0.0
+	github.com/BetaLixT/gowebstd/infra/tracelib v0.0.0
 	github.com/Soreing/apex v0.3.1
 	github.com/Soreing/motel v0.1.2
 	github.com/prometheus/client_golang v1.14.0
@@ -34,3 +35,5 @@ require (
 )
 
 replace github.com/BetaLixT/gowebstd v0.0.0 => ../..
+
+replace github.com/BetaLixT/gowebstd/infra/tracelib => ../tracelib
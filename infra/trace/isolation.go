@@ -0,0 +1,303 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrExporterQueueFull = errors.New("exporter queue full")
+	ErrExporterTimeout   = errors.New("exporter timed out")
+	ErrExporterClosed    = errors.New("exporter closed")
+)
+
+// IsolationOptions options for isolating exporters from each other, each
+// exporter gets its own queue and worker so a slow or failing exporter does
+// not hold up the others
+type IsolationOptions struct {
+	// QueueSize number of batches buffered per exporter, defaults to 1024
+	QueueSize int
+	// Timeout for a single export attempt, defaults to 10 seconds
+	Timeout time.Duration
+	// MaxRetries number of retries after a failed export attempt
+	MaxRetries int
+	// RetryBackoff initial delay between retries, doubled on every retry,
+	// defaults to 100 milliseconds
+	RetryBackoff time.Duration
+	// BreakerThreshold consecutive failed exports before the circuit opens,
+	// defaults to 5
+	BreakerThreshold int
+	// BreakerCooldown time the circuit stays open before an export is
+	// attempted again, defaults to 30 seconds
+	BreakerCooldown time.Duration
+	// MetricsPrefix prefix of the exporter metrics, defaults to "trace"
+	MetricsPrefix string
+}
+
+// Circuit breaker states of an exporter
+const (
+	ExporterHealthy  = "healthy"
+	ExporterDegraded = "degraded"
+	ExporterOpen     = "open"
+)
+
+// ExporterHealth health status of an isolated exporter
+type ExporterHealth struct {
+	Name                string
+	State               string
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	QueueLength         int
+}
+
+// exporterMetrics metrics shared by all isolated exporters
+type exporterMetrics struct {
+	exports prometheus.CounterVec
+	latency prometheus.HistogramVec
+}
+
+func newExporterMetrics(prefix string) *exporterMetrics {
+	return &exporterMetrics{
+		exports: *promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_exporter_batches_total",
+			Help: "The number of span batches handled by each exporter",
+		}, []string{"exporter", "status"}),
+		latency: *promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_exporter_latency",
+			Help:    "The latency of span exports",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.3, 1, 3, 10, 30},
+		}, []string{"exporter"}),
+	}
+}
+
+// IsolatedExporter wraps an exporter with its own queue, timeout, retries and
+// circuit breaker
+type IsolatedExporter struct {
+	name    string
+	exp     sdktrace.SpanExporter
+	opts    IsolationOptions
+	metrics *exporterMetrics
+	lgr     *zap.Logger
+
+	queue chan []sdktrace.ReadOnlySpan
+	wg    *sync.WaitGroup
+
+	mtx         *sync.RWMutex
+	closed      bool
+	failures    int
+	openedAt    time.Time
+	lastError   string
+	lastSuccess time.Time
+}
+
+var _ sdktrace.SpanExporter = (*IsolatedExporter)(nil)
+
+// Fills in the defaults for unset options
+func (opts IsolationOptions) withDefaults() IsolationOptions {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 100 * time.Millisecond
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+	if opts.MetricsPrefix == "" {
+		opts.MetricsPrefix = "trace"
+	}
+	return opts
+}
+
+func newIsolatedExporter(
+	name string,
+	exp sdktrace.SpanExporter,
+	opts IsolationOptions,
+	metrics *exporterMetrics,
+	lgr *zap.Logger,
+) *IsolatedExporter {
+	ie := &IsolatedExporter{
+		name:    name,
+		exp:     exp,
+		opts:    opts,
+		metrics: metrics,
+		lgr:     lgr.With(zap.String("exporter", name)),
+		queue:   make(chan []sdktrace.ReadOnlySpan, opts.QueueSize),
+		wg:      &sync.WaitGroup{},
+		mtx:     &sync.RWMutex{},
+	}
+	ie.wg.Add(1)
+	go ie.worker()
+	return ie
+}
+
+// ExportSpans queues a copy of the spans for export, spans are dropped if the
+// queue is full
+func (ie *IsolatedExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	ie.mtx.RLock()
+	defer ie.mtx.RUnlock()
+	if ie.closed {
+		return ErrExporterClosed
+	}
+
+	// batching processors reuse the slice once the export returns
+	batch := make([]sdktrace.ReadOnlySpan, len(spans))
+	copy(batch, spans)
+	select {
+	case ie.queue <- batch:
+		return nil
+	default:
+		ie.metrics.exports.WithLabelValues(ie.name, "dropped").Inc()
+		return ErrExporterQueueFull
+	}
+}
+
+// Shutdown stops accepting spans, waits for the queue to drain (or the
+// context to be done) and shuts the wrapped exporter down
+func (ie *IsolatedExporter) Shutdown(ctx context.Context) error {
+	ie.mtx.Lock()
+	if ie.closed {
+		ie.mtx.Unlock()
+		return nil
+	}
+	ie.closed = true
+	close(ie.queue)
+	ie.mtx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ie.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return ie.exp.Shutdown(ctx)
+}
+
+// Health reports the current state of the exporter
+func (ie *IsolatedExporter) Health() ExporterHealth {
+	ie.mtx.RLock()
+	defer ie.mtx.RUnlock()
+
+	state := ExporterHealthy
+	if ie.failures >= ie.opts.BreakerThreshold {
+		state = ExporterOpen
+	} else if ie.failures > 0 {
+		state = ExporterDegraded
+	}
+	return ExporterHealth{
+		Name:                ie.name,
+		State:               state,
+		ConsecutiveFailures: ie.failures,
+		LastError:           ie.lastError,
+		LastSuccess:         ie.lastSuccess,
+		QueueLength:         len(ie.queue),
+	}
+}
+
+func (ie *IsolatedExporter) worker() {
+	defer ie.wg.Done()
+	for spans := range ie.queue {
+		if !ie.allow() {
+			ie.metrics.exports.WithLabelValues(ie.name, "rejected").Inc()
+			continue
+		}
+
+		start := time.Now()
+		err := ie.exportWithRetry(spans)
+		ie.metrics.latency.WithLabelValues(ie.name).Observe(
+			time.Since(start).Seconds(),
+		)
+		ie.record(err)
+	}
+}
+
+// Checks if the circuit allows an export, once the cooldown has passed a
+// single export is let through to probe the exporter
+func (ie *IsolatedExporter) allow() bool {
+	ie.mtx.Lock()
+	defer ie.mtx.Unlock()
+	if ie.failures < ie.opts.BreakerThreshold {
+		return true
+	}
+	if time.Since(ie.openedAt) < ie.opts.BreakerCooldown {
+		return false
+	}
+	ie.openedAt = time.Now()
+	return true
+}
+
+func (ie *IsolatedExporter) record(err error) {
+	ie.mtx.Lock()
+	defer ie.mtx.Unlock()
+	if err == nil {
+		ie.metrics.exports.WithLabelValues(ie.name, "success").Inc()
+		ie.failures = 0
+		ie.lastSuccess = time.Now()
+		return
+	}
+
+	ie.metrics.exports.WithLabelValues(ie.name, "failed").Inc()
+	ie.failures++
+	ie.lastError = err.Error()
+	if ie.failures == ie.opts.BreakerThreshold {
+		ie.openedAt = time.Now()
+		ie.lgr.Warn("exporter circuit opened", zap.Error(err))
+	}
+}
+
+func (ie *IsolatedExporter) exportWithRetry(
+	spans []sdktrace.ReadOnlySpan,
+) (err error) {
+	delay := ie.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if err = ie.exportWithTimeout(spans); err == nil {
+			return nil
+		}
+		if attempt >= ie.opts.MaxRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Runs the export in a separate routine so that exporters that ignore the
+// context can't block the worker past the timeout
+func (ie *IsolatedExporter) exportWithTimeout(
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ie.opts.Timeout)
+	defer cancel()
+
+	res := make(chan error, 1)
+	go func() {
+		res <- ie.exp.ExportSpans(ctx, spans)
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ErrExporterTimeout
+	}
+}
@@ -0,0 +1,280 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+var errExport = errors.New("export failed")
+
+// fakeExporter records the batches it receives, failing or blocking on
+// demand
+type fakeExporter struct {
+	mtx      sync.Mutex
+	err      error
+	block    chan struct{}
+	started  chan struct{}
+	batches  [][]string
+	shutdown bool
+}
+
+func (f *fakeExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name()
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.batches = append(f.batches, names)
+	return f.err
+}
+
+func (f *fakeExporter) Shutdown(ctx context.Context) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.shutdown = true
+	return nil
+}
+
+func (f *fakeExporter) setErr(err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.err = err
+}
+
+func (f *fakeExporter) calls() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.batches)
+}
+
+// Creates metrics that aren't registered so tests don't collide
+func newTestMetrics() *exporterMetrics {
+	return &exporterMetrics{
+		exports: *prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "test_exporter_batches_total",
+		}, []string{"exporter", "status"}),
+		latency: *prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "test_exporter_latency",
+		}, []string{"exporter"}),
+	}
+}
+
+func newTestExporter(
+	fake *fakeExporter,
+	opts IsolationOptions,
+) *IsolatedExporter {
+	return newIsolatedExporter(
+		"fake", fake, opts.withDefaults(), newTestMetrics(), zap.NewNop(),
+	)
+}
+
+func spans(names ...string) []sdktrace.ReadOnlySpan {
+	stubs := make(tracetest.SpanStubs, len(names))
+	for i, name := range names {
+		stubs[i].Name = name
+	}
+	return stubs.Snapshots()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIsolatedExporterBreakerOpens(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		retries   int
+		batches   int
+		calls     int
+		state     string
+	}{
+		{name: "below threshold", threshold: 3, batches: 2, calls: 2, state: ExporterDegraded},
+		{name: "at threshold", threshold: 3, batches: 3, calls: 3, state: ExporterOpen},
+		{name: "rejected once open", threshold: 3, batches: 6, calls: 3, state: ExporterOpen},
+		{name: "retries count as one failure", threshold: 2, retries: 1, batches: 4, calls: 4, state: ExporterOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeExporter{err: errExport}
+			ie := newTestExporter(fake, IsolationOptions{
+				BreakerThreshold: tt.threshold,
+				BreakerCooldown:  time.Hour,
+				MaxRetries:       tt.retries,
+				RetryBackoff:     time.Millisecond,
+			})
+			for i := 0; i < tt.batches; i++ {
+				if err := ie.ExportSpans(context.Background(), spans("a")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ie.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fake.calls(); got != tt.calls {
+				t.Errorf("expected %d export calls, got %d", tt.calls, got)
+			}
+			health := ie.Health()
+			if health.State != tt.state {
+				t.Errorf("expected state %s, got %s", tt.state, health.State)
+			}
+			if health.LastError != errExport.Error() {
+				t.Errorf("unexpected last error %q", health.LastError)
+			}
+		})
+	}
+}
+
+func TestIsolatedExporterProbe(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	fake := &fakeExporter{err: errExport}
+	ie := newTestExporter(fake, IsolationOptions{
+		BreakerThreshold: 1,
+		BreakerCooldown:  cooldown,
+	})
+	defer ie.Shutdown(context.Background())
+
+	ie.ExportSpans(context.Background(), spans("a"))
+	waitFor(t, func() bool { return ie.Health().State == ExporterOpen })
+
+	// a single probe is let through once the cooldown has passed
+	time.Sleep(cooldown)
+	ie.ExportSpans(context.Background(), spans("b"))
+	ie.ExportSpans(context.Background(), spans("c"))
+	waitFor(t, func() bool { return ie.Health().QueueLength == 0 })
+	time.Sleep(10 * time.Millisecond)
+	if got := fake.calls(); got != 2 {
+		t.Fatalf("expected a single probe, got %d export calls", got)
+	}
+	if ie.Health().State != ExporterOpen {
+		t.Fatal("expected the circuit to stay open after a failed probe")
+	}
+
+	// a successful probe closes the circuit
+	fake.setErr(nil)
+	time.Sleep(cooldown)
+	ie.ExportSpans(context.Background(), spans("d"))
+	waitFor(t, func() bool { return ie.Health().State == ExporterHealthy })
+	if got := fake.calls(); got != 3 {
+		t.Errorf("expected 3 export calls, got %d", got)
+	}
+}
+
+func TestIsolatedExporterQueueFull(t *testing.T) {
+	fake := &fakeExporter{
+		block:   make(chan struct{}),
+		started: make(chan struct{}, 3),
+	}
+	ie := newTestExporter(fake, IsolationOptions{QueueSize: 1})
+
+	// the first batch is taken by the worker, the second fills the queue
+	if err := ie.ExportSpans(context.Background(), spans("a")); err != nil {
+		t.Fatal(err)
+	}
+	<-fake.started
+	if err := ie.ExportSpans(context.Background(), spans("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ie.ExportSpans(context.Background(), spans("c")); err != ErrExporterQueueFull {
+		t.Fatalf("expected ErrExporterQueueFull, got %v", err)
+	}
+
+	close(fake.block)
+	if err := ie.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.calls(); got != 2 {
+		t.Errorf("expected the dropped batch not to be exported, got %d calls", got)
+	}
+}
+
+func TestIsolatedExporterTimeout(t *testing.T) {
+	fake := &fakeExporter{block: make(chan struct{})}
+	defer close(fake.block)
+	ie := newTestExporter(fake, IsolationOptions{
+		Timeout:          20 * time.Millisecond,
+		BreakerThreshold: 1,
+	})
+
+	start := time.Now()
+	ie.ExportSpans(context.Background(), spans("a"))
+	waitFor(t, func() bool { return ie.Health().State == ExporterOpen })
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the export to time out, took %s", elapsed)
+	}
+	if got := ie.Health().LastError; got != ErrExporterTimeout.Error() {
+		t.Errorf("expected a timeout error, got %q", got)
+	}
+}
+
+func TestIsolatedExporterShutdownDrains(t *testing.T) {
+	fake := &fakeExporter{}
+	ie := newTestExporter(fake, IsolationOptions{})
+
+	for i := 0; i < 10; i++ {
+		if err := ie.ExportSpans(context.Background(), spans("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ie.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.calls(); got != 10 {
+		t.Errorf("expected every queued batch to be exported, got %d", got)
+	}
+	if !fake.shutdown {
+		t.Error("expected the wrapped exporter to be shut down")
+	}
+	if err := ie.ExportSpans(context.Background(), spans("a")); err != ErrExporterClosed {
+		t.Errorf("expected ErrExporterClosed, got %v", err)
+	}
+}
+
+func TestIsolatedExporterCopiesBatch(t *testing.T) {
+	fake := &fakeExporter{
+		block:   make(chan struct{}),
+		started: make(chan struct{}, 1),
+	}
+	ie := newTestExporter(fake, IsolationOptions{})
+
+	batch := spans("a", "b")
+	ie.ExportSpans(context.Background(), batch)
+	<-fake.started
+	// a batching processor reuses its slice for the next batch
+	copy(batch, spans("c", "d"))
+
+	close(fake.block)
+	if err := ie.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.batches[0]; got[0] != "a" || got[1] != "b" {
+		t.Errorf("expected the queued batch to be unchanged, got %v", got)
+	}
+}
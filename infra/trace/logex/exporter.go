@@ -11,6 +11,7 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	trace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // TraceExporter an application insights exporter
@@ -106,9 +107,35 @@ func (exp *LoggerExporter) process(sp sdktrace.ReadOnlySpan) {
 	for key := range props {
 		fields = append(fields, zap.String(key, props[key]))
 	}
+	if links := sp.Links(); len(links) > 0 {
+		fields = append(fields, zap.Array("links", spanLinks(links)))
+	}
 
 	exp.lgr.Info(
 		msg,
 		fields...,
 	)
 }
+
+// spanLinks renders the links of a span as an array of objects
+type spanLinks []sdktrace.Link
+
+func (lnks spanLinks) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for i := range lnks {
+		if err := enc.AppendObject(spanLink(lnks[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type spanLink sdktrace.Link
+
+func (lnk spanLink) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("tid", lnk.SpanContext.TraceID().String())
+	enc.AddString("sid", lnk.SpanContext.SpanID().String())
+	for _, e := range lnk.Attributes {
+		enc.AddString(string(e.Key), e.Value.AsString())
+	}
+	return nil
+}
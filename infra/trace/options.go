@@ -1,7 +1,14 @@
 // Package trace implementing tracing functionality
 package trace
 
+import "github.com/BetaLixT/gowebstd/redact"
+
 // Options defines all options related to the trace library
 type Options struct {
 	ServiceName string
+	// Redaction if set, span attributes are redacted before being exported
+	Redaction *redact.Options
+	// Isolation if set, every exporter of NewIsolatedTraceExporterList is
+	// isolated with its own queue, retries and circuit breaker
+	Isolation *IsolationOptions
 }
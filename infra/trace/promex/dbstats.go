@@ -0,0 +1,156 @@
+package promex
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IStatsProvider anything that reports connection pool stats, *sql.DB,
+// *sqlx.DB and *tsqlx.TracedDB all satisfy it
+type IStatsProvider interface {
+	Stats() sql.DBStats
+}
+
+// DBStatsCollector collects the connection pool stats of named databases
+type DBStatsCollector struct {
+	mtx *sync.RWMutex
+	dbs map[string]IStatsProvider
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+	closed       *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*DBStatsCollector)(nil)
+
+// NewDBStatsCollector constructs the pool stats collector and registers it
+// with the default registry, the same registry the exporter uses
+func NewDBStatsCollector() (*DBStatsCollector, error) {
+	col := NewDBStatsCollectorWithPrefix("promex")
+	if err := prometheus.Register(col); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+// NewDBStatsCollectorWithPrefix constructs an unregistered pool stats
+// collector
+func NewDBStatsCollectorWithPrefix(prefix string) *DBStatsCollector {
+	labels := []string{"database"}
+	return &DBStatsCollector{
+		mtx: &sync.RWMutex{},
+		dbs: map[string]IStatsProvider{},
+
+		maxOpen: prometheus.NewDesc(
+			prefix+"_db_max_open_connections",
+			"Maximum number of open connections to the database",
+			labels, nil,
+		),
+		open: prometheus.NewDesc(
+			prefix+"_db_open_connections",
+			"The number of established connections both in use and idle",
+			labels, nil,
+		),
+		inUse: prometheus.NewDesc(
+			prefix+"_db_in_use_connections",
+			"The number of connections currently in use",
+			labels, nil,
+		),
+		idle: prometheus.NewDesc(
+			prefix+"_db_idle_connections",
+			"The number of idle connections",
+			labels, nil,
+		),
+		waitCount: prometheus.NewDesc(
+			prefix+"_db_wait_count_total",
+			"The total number of connections waited for",
+			labels, nil,
+		),
+		waitDuration: prometheus.NewDesc(
+			prefix+"_db_wait_duration_seconds_total",
+			"The total time blocked waiting for a new connection",
+			labels, nil,
+		),
+		closed: prometheus.NewDesc(
+			prefix+"_db_closed_connections_total",
+			"The total number of connections closed by reason",
+			[]string{"database", "reason"}, nil,
+		),
+	}
+}
+
+// Add starts collecting the stats of the database under the name, usually the
+// DatabaseServiceName
+func (col *DBStatsCollector) Add(name string, db IStatsProvider) {
+	col.mtx.Lock()
+	defer col.mtx.Unlock()
+	col.dbs[name] = db
+}
+
+// Remove stops collecting the stats of the database
+func (col *DBStatsCollector) Remove(name string) {
+	col.mtx.Lock()
+	defer col.mtx.Unlock()
+	delete(col.dbs, name)
+}
+
+func (col *DBStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- col.maxOpen
+	ch <- col.open
+	ch <- col.inUse
+	ch <- col.idle
+	ch <- col.waitCount
+	ch <- col.waitDuration
+	ch <- col.closed
+}
+
+func (col *DBStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	col.mtx.RLock()
+	defer col.mtx.RUnlock()
+
+	for name, db := range col.dbs {
+		st := db.Stats()
+		ch <- prometheus.MustNewConstMetric(
+			col.maxOpen, prometheus.GaugeValue,
+			float64(st.MaxOpenConnections), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.open, prometheus.GaugeValue,
+			float64(st.OpenConnections), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.inUse, prometheus.GaugeValue,
+			float64(st.InUse), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.idle, prometheus.GaugeValue,
+			float64(st.Idle), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.waitCount, prometheus.CounterValue,
+			float64(st.WaitCount), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.waitDuration, prometheus.CounterValue,
+			st.WaitDuration.Seconds(), name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.closed, prometheus.CounterValue,
+			float64(st.MaxIdleClosed), name, "max_idle",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.closed, prometheus.CounterValue,
+			float64(st.MaxIdleTimeClosed), name, "max_idle_time",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			col.closed, prometheus.CounterValue,
+			float64(st.MaxLifetimeClosed), name, "max_lifetime",
+		)
+	}
+}
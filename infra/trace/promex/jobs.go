@@ -0,0 +1,63 @@
+package promex
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// JobMetrics metrics of background job runs, it's registered with the default
+// registry and can be passed to the psqldb job pool
+type JobMetrics struct {
+	started  prometheus.CounterVec
+	finished prometheus.CounterVec
+	latency  prometheus.HistogramVec
+	inFlight prometheus.GaugeVec
+}
+
+// NewJobMetrics constructs the job metrics with the promex prefix
+func NewJobMetrics() *JobMetrics {
+	return NewJobMetricsWithPrefix("promex")
+}
+
+// NewJobMetricsWithPrefix constructs the job metrics
+func NewJobMetricsWithPrefix(prefix string) *JobMetrics {
+	return &JobMetrics{
+		started: *promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_jobs_started_total",
+			Help: "The total number of started jobs",
+		}, []string{"queue", "kind"}),
+		finished: *promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_jobs_finished_total",
+			Help: "The outcome of finished jobs",
+		}, []string{"queue", "kind", "status"}),
+		latency: *promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_jobs_latency",
+			Help:    "The run time of jobs",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+		}, []string{"queue", "kind"}),
+		inFlight: *promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "_jobs_in_flight",
+			Help: "The number of jobs currently running",
+		}, []string{"queue", "kind"}),
+	}
+}
+
+// JobStarted records the start of a job run
+func (m *JobMetrics) JobStarted(queue string, kind string) {
+	m.started.WithLabelValues(queue, kind).Inc()
+	m.inFlight.WithLabelValues(queue, kind).Inc()
+}
+
+// JobFinished records the outcome and run time of a job run
+func (m *JobMetrics) JobFinished(
+	queue string,
+	kind string,
+	status string,
+	duration time.Duration,
+) {
+	m.inFlight.WithLabelValues(queue, kind).Dec()
+	m.finished.WithLabelValues(queue, kind, status).Inc()
+	m.latency.WithLabelValues(queue, kind).Observe(duration.Seconds())
+}
@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/BetaLixT/gowebstd/redact"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewRedactingExporter wraps the exporter so that span attributes are
+// redacted before they are exported
+func NewRedactingExporter(
+	exp sdktrace.SpanExporter,
+	rdc *redact.Redactor,
+) sdktrace.SpanExporter {
+	return &redactingExporter{
+		exp: exp,
+		rdc: rdc,
+	}
+}
+
+type redactingExporter struct {
+	exp sdktrace.SpanExporter
+	rdc *redact.Redactor
+}
+
+func (re *redactingExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i := range spans {
+		redacted[i] = &redactedSpan{
+			ReadOnlySpan: spans[i],
+			attributes:   re.redact(spans[i].Attributes()),
+		}
+	}
+	return re.exp.ExportSpans(ctx, redacted)
+}
+
+func (re *redactingExporter) Shutdown(ctx context.Context) error {
+	return re.exp.Shutdown(ctx)
+}
+
+func (re *redactingExporter) redact(
+	attr []attribute.KeyValue,
+) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, len(attr))
+	for i, e := range attr {
+		switch {
+		case e.Value.Type() == attribute.STRING:
+			out[i] = attribute.String(
+				string(e.Key),
+				re.rdc.Redact(string(e.Key), e.Value.AsString()),
+			)
+		case re.rdc.IsDenied(string(e.Key)):
+			out[i] = attribute.String(
+				string(e.Key),
+				re.rdc.Redact(string(e.Key), e.Value.Emit()),
+			)
+		default:
+			out[i] = e
+		}
+	}
+	return out
+}
+
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+}
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue {
+	return s.attributes
+}
@@ -5,12 +5,35 @@ import (
 
 	"github.com/BetaLixT/gowebstd/externals/logger"
 	"github.com/BetaLixT/gowebstd/infra/tracelib"
+	"github.com/BetaLixT/gowebstd/redact"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // ExporterList stores and provides a list of exporters
 type ExporterList struct {
 	Exporters []sdktrace.SpanExporter
+	isolated  []*IsolatedExporter
+}
+
+// Health reports the health of every isolated exporter, empty if exporter
+// isolation is not enabled
+func (l *ExporterList) Health() []ExporterHealth {
+	health := make([]ExporterHealth, len(l.isolated))
+	for i := range l.isolated {
+		health[i] = l.isolated[i].Health()
+	}
+	return health
+}
+
+// Healthy checks that no isolated exporter has an open circuit, meant to be
+// used by readiness endpoints
+func (l *ExporterList) Healthy() bool {
+	for i := range l.isolated {
+		if l.isolated[i].Health().State == ExporterOpen {
+			return false
+		}
+	}
+	return true
 }
 
 // NewTracer constructs a new Tracer
@@ -21,9 +44,21 @@ func NewTracer(
 ) (*tracelib.Tracer, error) {
 	lgr := lgrf.Create(context.TODO())
 
+	exps := expl.Exporters
+	if opts.Redaction != nil {
+		rdc, err := redact.NewRedactor(opts.Redaction)
+		if err != nil {
+			return nil, err
+		}
+		exps = make([]sdktrace.SpanExporter, len(expl.Exporters))
+		for i := range expl.Exporters {
+			exps[i] = NewRedactingExporter(expl.Exporters[i], rdc)
+		}
+	}
+
 	return tracelib.NewTracer(
 		opts.ServiceName,
-		expl.Exporters,
+		exps,
 		&spanConstructor{},
 		&traceExtractor{},
 		lgr,
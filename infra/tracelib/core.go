@@ -13,9 +13,11 @@ import (
 
 	"github.com/Soreing/motel"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"go.uber.org/zap"
 )
@@ -28,6 +30,7 @@ type Tracer struct {
 	exporters   []sdktrace.SpanExporter
 	resource    *resource.Resource
 	rand        *mrand.Rand
+	processors  []ISpanProcessor
 }
 
 // Creates a random number generator
@@ -152,6 +155,27 @@ func NewTracer(
 	}, nil
 }
 
+// UseSpanProcessors appends span processors to the tracer, processors are run
+// in the order they were added for every span before it's exported, this is
+// expected to be called while setting up the tracer, before any span is traced
+func (ins *Tracer) UseSpanProcessors(processors ...ISpanProcessor) {
+	ins.processors = append(ins.processors, processors...)
+}
+
+// Runs the span through the processors and feeds it to the collector unless
+// it was dropped
+func (ins *Tracer) feed(ctx context.Context, span motel.Span) {
+	for _, p := range ins.processors {
+		p.OnStart(ctx, span)
+	}
+	for _, p := range ins.processors {
+		if span = p.OnEnd(span); span == nil {
+			return
+		}
+	}
+	ins.collector.Feed(span)
+}
+
 // Closes the span collector
 func (ins *Tracer) Close() {
 	ins.collector.Close()
@@ -232,7 +256,7 @@ func (ins *Tracer) TraceRequest(
 		method, path, query, statusCode, bodySize, ip,
 		userAgent, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(ctx, span)
 }
 
 // TraceEvent will trace an incomming event
@@ -252,7 +276,58 @@ func (ins *Tracer) TraceEvent(
 		tidb, pidb, ridb, ins.resource,
 		name, key, statusCode, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(ctx, span)
+}
+
+// TraceEventWithLinks will trace an incomming event that is linked to other
+// spans, such as the producers of a batch of messages
+func (ins *Tracer) TraceEventWithLinks(
+	ctx context.Context,
+	name string,
+	key string,
+	statusCode int,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+	links []SpanLink,
+) {
+	_, tid, pid, rid, _ := ins.extractor.ExtractTraceInfo(ctx)
+	tidb, pidb, ridb := stobTraceIds(tid, pid, rid)
+
+	span := ins.constructor.NewEventSpan(
+		tidb, pidb, ridb, ins.resource,
+		name, key, statusCode, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(ctx, withLinks(span, links))
+}
+
+// TraceSpan will trace a generic span as a child of the current request, a
+// new span id is generated if spanId is empty
+func (ins *Tracer) TraceSpan(
+	ctx context.Context,
+	spanId string,
+	name string,
+	kind trace.SpanKind,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+	links []SpanLink,
+) {
+	_, tid, _, rid, _ := ins.extractor.ExtractTraceInfo(ctx)
+	tidb, pidb, sidb := stobTraceIds(tid, rid, spanId)
+	if spanId == "" {
+		var err error
+		if sidb, err = ins.CreateResourceIdBytes(); err != nil {
+			return
+		}
+	}
+
+	span := newGenericSpan(
+		tidb, pidb, sidb, ins.resource,
+		name, kind, success, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(ctx, withLinks(span, links))
 }
 
 // TraceDependency will trace calls to external dependencies
@@ -282,7 +357,7 @@ func (ins *Tracer) TraceDependency(
 		dependencyType, serviceName, commandName,
 		success, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(ctx, span)
 }
 
 // - Context Independent
@@ -310,7 +385,7 @@ func (ins *Tracer) TraceRequestWithIds(
 		method, path, query, statusCode, bodySize, ip,
 		userAgent, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(context.Background(), span)
 }
 
 // TraceEventWithIds trace incoming events without a context
@@ -324,6 +399,26 @@ func (ins *Tracer) TraceEventWithIds(
 	startTimestamp time.Time,
 	eventTimestamp time.Time,
 	fields map[string]string,
+) {
+	ins.TraceEventWithIdsAndLinks(
+		traceId, parentId, requestId, name, key, statusCode,
+		startTimestamp, eventTimestamp, fields, nil,
+	)
+}
+
+// TraceEventWithIdsAndLinks trace incoming events without a context that are
+// linked to other spans, such as the producers of a batch of messages
+func (ins *Tracer) TraceEventWithIdsAndLinks(
+	traceId string,
+	parentId string,
+	requestId string,
+	name string,
+	key string,
+	statusCode int,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+	links []SpanLink,
 ) {
 	tidb, pidb, ridb := stobTraceIds(traceId, parentId, requestId)
 
@@ -331,7 +426,7 @@ func (ins *Tracer) TraceEventWithIds(
 		tidb, pidb, ridb, ins.resource,
 		name, key, statusCode, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(context.Background(), withLinks(span, links))
 }
 
 // TraceDependencyWithIds trace dependencies without a context
@@ -361,5 +456,160 @@ func (ins *Tracer) TraceDependencyWithIds(
 		dependencyType, serviceName, commandName,
 		success, startTimestamp, eventTimestamp, fields,
 	)
-	ins.collector.Feed(span)
+	ins.feed(context.Background(), span)
+}
+
+// - Handle based
+
+// TraceRequestWithHandle traces an incoming request as a child of the parent
+// handle and returns the handle of the traced request span
+func (ins *Tracer) TraceRequestWithHandle(
+	parent TraceHandle,
+	method string,
+	path string,
+	query string,
+	statusCode int,
+	bodySize int,
+	ip string,
+	userAgent string,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) (TraceHandle, error) {
+	child, err := parent.Child()
+	if err != nil {
+		return TraceHandle{}, err
+	}
+
+	span := ins.constructor.NewRequestSpan(
+		child.TraceId, parent.SpanId, child.SpanId, ins.resource,
+		method, path, query, statusCode, bodySize, ip,
+		userAgent, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(context.Background(), span)
+	return child, nil
+}
+
+// TraceEventWithHandle traces an incoming event as a child of the parent
+// handle and returns the handle of the traced event span
+func (ins *Tracer) TraceEventWithHandle(
+	parent TraceHandle,
+	name string,
+	key string,
+	statusCode int,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) (TraceHandle, error) {
+	return ins.TraceEventWithHandleAndLinks(
+		parent, name, key, statusCode,
+		startTimestamp, eventTimestamp, fields, nil,
+	)
+}
+
+// TraceEventWithHandleAndLinks traces an incoming event as a child of the
+// parent handle that is linked to other spans, such as the producers of a
+// batch of messages, and returns the handle of the traced event span
+func (ins *Tracer) TraceEventWithHandleAndLinks(
+	parent TraceHandle,
+	name string,
+	key string,
+	statusCode int,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+	links []SpanLink,
+) (TraceHandle, error) {
+	child, err := parent.Child()
+	if err != nil {
+		return TraceHandle{}, err
+	}
+
+	span := ins.constructor.NewEventSpan(
+		child.TraceId, parent.SpanId, child.SpanId, ins.resource,
+		name, key, statusCode, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(context.Background(), withLinks(span, links))
+	return child, nil
+}
+
+// TraceDependencyWithHandle traces a call to an external dependency as a child
+// of the parent handle and returns the handle of the traced dependency span
+func (ins *Tracer) TraceDependencyWithHandle(
+	parent TraceHandle,
+	dependencyType string,
+	serviceName string,
+	commandName string,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) (TraceHandle, error) {
+	child, err := parent.Child()
+	if err != nil {
+		return TraceHandle{}, err
+	}
+
+	res, _ := resource.New(
+		context.TODO(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+
+	span := ins.constructor.NewDependencySpan(
+		child.TraceId, parent.SpanId, child.SpanId, ins.resource, res,
+		dependencyType, serviceName, commandName,
+		success, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(context.Background(), span)
+	return child, nil
+}
+
+// TraceSpanWithHandle traces a generic span as a child of the parent handle
+// and returns the handle of the traced span
+func (ins *Tracer) TraceSpanWithHandle(
+	parent TraceHandle,
+	name string,
+	kind trace.SpanKind,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+	links []SpanLink,
+) (TraceHandle, error) {
+	child, err := parent.Child()
+	if err != nil {
+		return TraceHandle{}, err
+	}
+
+	span := newGenericSpan(
+		child.TraceId, parent.SpanId, child.SpanId, ins.resource,
+		name, kind, success, startTimestamp, eventTimestamp, fields,
+	)
+	ins.feed(context.Background(), withLinks(span, links))
+	return child, nil
+}
+
+// Creates a span that is not specific to requests, events or dependencies,
+// fields are added as attributes
+func newGenericSpan(
+	tid [16]byte, pid [8]byte, sid [8]byte,
+	res *resource.Resource,
+	name string,
+	kind trace.SpanKind,
+	success bool,
+	startTimestamp time.Time,
+	eventTimestamp time.Time,
+	fields map[string]string,
+) motel.Span {
+	span := motel.CreateSpan(
+		name, kind,
+		res, tid, pid, sid, 0x01,
+		success, startTimestamp, eventTimestamp,
+	)
+	for key, val := range fields {
+		span.WithAttribute(attribute.Key(key), attribute.StringValue(val))
+	}
+	return span
 }
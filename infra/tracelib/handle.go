@@ -0,0 +1,122 @@
+package tracelib
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidTraceId     = errors.New("invalid trace id")
+	ErrInvalidSpanId      = errors.New("invalid span id")
+	ErrInvalidTraceFlags  = errors.New("invalid trace flags")
+	ErrInvalidTraceParent = errors.New("invalid traceparent header")
+)
+
+// TraceHandle is a lightweight value carrying the w3c trace information of a
+// single span, it's meant for code that does not have an IContext (background
+// workers, message consumers etc.) so that spans can be created and chained
+// by passing the handle along
+type TraceHandle struct {
+	TraceId [16]byte
+	SpanId  [8]byte
+	Flags   byte
+}
+
+// NewTraceHandle creates a handle for a brand new trace with random trace and
+// span ids, the sampled flag is set
+func NewTraceHandle() (TraceHandle, error) {
+	h := TraceHandle{Flags: 0x01}
+	if _, err := crand.Read(h.TraceId[:]); err != nil {
+		return TraceHandle{}, err
+	}
+	if _, err := crand.Read(h.SpanId[:]); err != nil {
+		return TraceHandle{}, err
+	}
+	return h, nil
+}
+
+// ParseTraceHandle creates a handle from hex encoded trace id, span id and
+// flags, an empty flags string defaults to sampled
+func ParseTraceHandle(
+	traceId string,
+	spanId string,
+	flags string,
+) (TraceHandle, error) {
+	h := TraceHandle{Flags: 0x01}
+
+	tid, err := hex.DecodeString(traceId)
+	if err != nil || len(tid) != 16 {
+		return TraceHandle{}, ErrInvalidTraceId
+	}
+	sid, err := hex.DecodeString(spanId)
+	if err != nil || len(sid) != 8 {
+		return TraceHandle{}, ErrInvalidSpanId
+	}
+	if flags != "" {
+		flg, err := hex.DecodeString(flags)
+		if err != nil || len(flg) != 1 {
+			return TraceHandle{}, ErrInvalidTraceFlags
+		}
+		h.Flags = flg[0]
+	}
+
+	copy(h.TraceId[:], tid)
+	copy(h.SpanId[:], sid)
+	return h, nil
+}
+
+// ParseTraceParent creates a handle from a w3c traceparent header value
+// (ver-tid-sid-flg)
+func ParseTraceParent(header string) (TraceHandle, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 {
+		return TraceHandle{}, ErrInvalidTraceParent
+	}
+	return ParseTraceHandle(parts[1], parts[2], parts[3])
+}
+
+// Child derives a handle for a new span in the same trace, the span id of the
+// receiver should be used as the parent id of the child span
+func (h TraceHandle) Child() (TraceHandle, error) {
+	c := TraceHandle{
+		TraceId: h.TraceId,
+		Flags:   h.Flags,
+	}
+	if _, err := crand.Read(c.SpanId[:]); err != nil {
+		return TraceHandle{}, err
+	}
+	return c, nil
+}
+
+// IsValid checks that both the trace id and span id are non zero
+func (h TraceHandle) IsValid() bool {
+	return h.TraceId != [16]byte{} && h.SpanId != [8]byte{}
+}
+
+// TraceIdString hex encoded trace id
+func (h TraceHandle) TraceIdString() string {
+	return hex.EncodeToString(h.TraceId[:])
+}
+
+// SpanIdString hex encoded span id
+func (h TraceHandle) SpanIdString() string {
+	return hex.EncodeToString(h.SpanId[:])
+}
+
+// FlagsString hex encoded trace flags
+func (h TraceHandle) FlagsString() string {
+	return hex.EncodeToString([]byte{h.Flags})
+}
+
+// TraceParent formats the handle as a w3c traceparent header value
+func (h TraceHandle) TraceParent() string {
+	return fmt.Sprintf(
+		"00-%s-%s-%s",
+		h.TraceIdString(),
+		h.SpanIdString(),
+		h.FlagsString(),
+	)
+}
@@ -0,0 +1,164 @@
+package tracelib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		tid    string
+		sid    string
+		flags  string
+		err    error
+	}{
+		{
+			name:   "valid",
+			header: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			tid:    "0af7651916cd43dd8448eb211c80319c",
+			sid:    "b7ad6b7169203331",
+			flags:  "01",
+		},
+		{
+			name:   "unsampled with whitespace",
+			header: " 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00 ",
+			tid:    "0af7651916cd43dd8448eb211c80319c",
+			sid:    "b7ad6b7169203331",
+			flags:  "00",
+		},
+		{
+			name:   "empty",
+			header: "",
+			err:    ErrInvalidTraceParent,
+		},
+		{
+			name:   "missing part",
+			header: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+			err:    ErrInvalidTraceParent,
+		},
+		{
+			name:   "bad version",
+			header: "000-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			err:    ErrInvalidTraceParent,
+		},
+		{
+			name:   "short trace id",
+			header: "00-0af7651916cd43dd-b7ad6b7169203331-01",
+			err:    ErrInvalidTraceId,
+		},
+		{
+			name:   "non hex trace id",
+			header: "00-zzf7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			err:    ErrInvalidTraceId,
+		},
+		{
+			name:   "long span id",
+			header: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333100-01",
+			err:    ErrInvalidSpanId,
+		},
+		{
+			name:   "bad flags",
+			header: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1",
+			err:    ErrInvalidTraceFlags,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ParseTraceParent(tt.header)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if h.TraceIdString() != tt.tid {
+				t.Errorf("expected trace id %s, got %s", tt.tid, h.TraceIdString())
+			}
+			if h.SpanIdString() != tt.sid {
+				t.Errorf("expected span id %s, got %s", tt.sid, h.SpanIdString())
+			}
+			if h.FlagsString() != tt.flags {
+				t.Errorf("expected flags %s, got %s", tt.flags, h.FlagsString())
+			}
+		})
+	}
+}
+
+func TestParseTraceHandleDefaultFlags(t *testing.T) {
+	h, err := ParseTraceHandle(
+		"0af7651916cd43dd8448eb211c80319c",
+		"b7ad6b7169203331",
+		"",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Flags != 0x01 {
+		t.Errorf("expected sampled flag, got %x", h.Flags)
+	}
+}
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	h, err := NewTraceHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsValid() {
+		t.Fatal("expected new handle to be valid")
+	}
+
+	parsed, err := ParseTraceParent(h.TraceParent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != h {
+		t.Errorf("expected %+v, got %+v", h, parsed)
+	}
+}
+
+func TestChild(t *testing.T) {
+	h, err := NewTraceHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := h.Child()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TraceId != h.TraceId {
+		t.Error("expected child to keep the trace id")
+	}
+	if c.SpanId == h.SpanId {
+		t.Error("expected child to get a new span id")
+	}
+	if c.Flags != h.Flags {
+		t.Error("expected child to keep the flags")
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		h     TraceHandle
+		valid bool
+	}{
+		{name: "zero", h: TraceHandle{}, valid: false},
+		{name: "no span", h: TraceHandle{TraceId: [16]byte{1}}, valid: false},
+		{name: "no trace", h: TraceHandle{SpanId: [8]byte{1}}, valid: false},
+		{
+			name:  "both",
+			h:     TraceHandle{TraceId: [16]byte{1}, SpanId: [8]byte{1}},
+			valid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.h.IsValid() != tt.valid {
+				t.Errorf("expected %v", tt.valid)
+			}
+		})
+	}
+}
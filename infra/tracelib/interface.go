@@ -62,3 +62,12 @@ type ISpanConstructor interface {
 		fields map[string]string,
 	) motel.Span
 }
+
+// ISpanProcessor hooks into every span traced by the Tracer before it's fed to
+// the exporters. OnStart is called for every processor first and may add
+// attributes to the span, OnEnd is then called for every processor in order
+// and returns the span to continue with, returning nil drops the span
+type ISpanProcessor interface {
+	OnStart(ctx context.Context, span motel.Span)
+	OnEnd(span motel.Span) motel.Span
+}
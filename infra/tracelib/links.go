@@ -0,0 +1,81 @@
+package tracelib
+
+import (
+	"github.com/Soreing/motel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanLink references a span (usually from another trace) that is causally
+// related to the span being traced, such as each message of a batch processed
+// by a consumer
+type SpanLink struct {
+	TraceId    [16]byte
+	SpanId     [8]byte
+	Attributes map[string]string
+}
+
+// NewSpanLink creates a link from hex encoded trace and span ids
+func NewSpanLink(
+	traceId string,
+	spanId string,
+	attributes map[string]string,
+) (SpanLink, error) {
+	h, err := ParseTraceHandle(traceId, spanId, "")
+	if err != nil {
+		return SpanLink{}, err
+	}
+	return h.Link(attributes), nil
+}
+
+// Link creates a link pointing to the span of the handle
+func (h TraceHandle) Link(attributes map[string]string) SpanLink {
+	return SpanLink{
+		TraceId:    h.TraceId,
+		SpanId:     h.SpanId,
+		Attributes: attributes,
+	}
+}
+
+// linkedSpan overrides the links of a motel span since motel does not
+// support them
+type linkedSpan struct {
+	motel.Span
+	links []sdktrace.Link
+}
+
+func (s *linkedSpan) Links() []sdktrace.Link {
+	return s.links
+}
+
+// Wraps the span with the links if any are provided
+func withLinks(span motel.Span, links []SpanLink) motel.Span {
+	if len(links) == 0 {
+		return span
+	}
+
+	lnks := make([]sdktrace.Link, 0, len(links))
+	for _, l := range links {
+		attr := make([]attribute.KeyValue, 0, len(l.Attributes))
+		for key, val := range l.Attributes {
+			attr = append(attr, attribute.String(key, val))
+		}
+		lnks = append(lnks, sdktrace.Link{
+			SpanContext: trace.NewSpanContext(
+				trace.SpanContextConfig{
+					TraceID:    l.TraceId,
+					SpanID:     l.SpanId,
+					TraceFlags: trace.FlagsSampled,
+					Remote:     true,
+				},
+			),
+			Attributes: attr,
+		})
+	}
+
+	return &linkedSpan{
+		Span:  span,
+		links: lnks,
+	}
+}
@@ -0,0 +1,101 @@
+package tracelib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Soreing/motel"
+)
+
+// captureProcessor keeps the spans and drops them before they're exported
+type captureProcessor struct {
+	spans []motel.Span
+}
+
+func (p *captureProcessor) OnStart(_ context.Context, _ motel.Span) {}
+
+func (p *captureProcessor) OnEnd(span motel.Span) motel.Span {
+	p.spans = append(p.spans, span)
+	return nil
+}
+
+func TestEventLinks(t *testing.T) {
+	parent, err := NewTraceHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer, err := NewTraceHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := []SpanLink{producer.Link(map[string]string{"message": "1"})}
+
+	tests := []struct {
+		name  string
+		links []SpanLink
+		trace func(tr *Tracer, links []SpanLink) error
+	}{
+		{
+			name:  "handle",
+			links: links,
+			trace: func(tr *Tracer, links []SpanLink) error {
+				_, err := tr.TraceEventWithHandleAndLinks(
+					parent, "batch", "orders", 200,
+					time.Now(), time.Now(), nil, links,
+				)
+				return err
+			},
+		},
+		{
+			name: "handle without links",
+			trace: func(tr *Tracer, links []SpanLink) error {
+				_, err := tr.TraceEventWithHandle(
+					parent, "batch", "orders", 200,
+					time.Now(), time.Now(), nil,
+				)
+				return err
+			},
+		},
+		{
+			name:  "ids",
+			links: links,
+			trace: func(tr *Tracer, links []SpanLink) error {
+				tr.TraceEventWithIdsAndLinks(
+					parent.TraceIdString(), parent.SpanIdString(), "",
+					"batch", "orders", 200, time.Now(), time.Now(), nil, links,
+				)
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := NewBasic("test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tr.Close()
+			cp := &captureProcessor{}
+			tr.UseSpanProcessors(cp)
+
+			if err := tt.trace(tr, tt.links); err != nil {
+				t.Fatal(err)
+			}
+			if len(cp.spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(cp.spans))
+			}
+			got := cp.spans[0].Links()
+			if len(got) != len(tt.links) {
+				t.Fatalf("expected %d links, got %d", len(tt.links), len(got))
+			}
+			for i, l := range tt.links {
+				sc := got[i].SpanContext
+				if sc.TraceID() != l.TraceId || sc.SpanID() != l.SpanId {
+					t.Errorf("unexpected link %v", sc)
+				}
+			}
+		})
+	}
+}
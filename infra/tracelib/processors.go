@@ -0,0 +1,132 @@
+package tracelib
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/Soreing/motel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AttributeProcessor enriches spans with static attributes and attributes
+// resolved from the context (such as a tenant id)
+type AttributeProcessor struct {
+	static  map[string]string
+	resolve func(ctx context.Context) map[string]string
+}
+
+var _ ISpanProcessor = (*AttributeProcessor)(nil)
+
+// NewAttributeProcessor constructs an attribute processor, either of static
+// or resolve can be nil
+func NewAttributeProcessor(
+	static map[string]string,
+	resolve func(ctx context.Context) map[string]string,
+) *AttributeProcessor {
+	return &AttributeProcessor{
+		static:  static,
+		resolve: resolve,
+	}
+}
+
+func (p *AttributeProcessor) OnStart(ctx context.Context, span motel.Span) {
+	for key, val := range p.static {
+		span.WithAttribute(attribute.Key(key), attribute.StringValue(val))
+	}
+	if p.resolve == nil {
+		return
+	}
+	for key, val := range p.resolve(ctx) {
+		span.WithAttribute(attribute.Key(key), attribute.StringValue(val))
+	}
+}
+
+func (p *AttributeProcessor) OnEnd(span motel.Span) motel.Span {
+	return span
+}
+
+// PathFilterProcessor drops request spans whose path matches any of the
+// patterns, useful for health checks and metrics scraping endpoints
+type PathFilterProcessor struct {
+	patterns []*regexp.Regexp
+}
+
+var _ ISpanProcessor = (*PathFilterProcessor)(nil)
+
+// NewPathFilterProcessor constructs a path filter processor, patterns are
+// regular expressions matched against the path of request spans
+func NewPathFilterProcessor(
+	patterns ...string,
+) (*PathFilterProcessor, error) {
+	p := &PathFilterProcessor{}
+	for _, pt := range patterns {
+		rgx, err := regexp.Compile(pt)
+		if err != nil {
+			return nil, err
+		}
+		p.patterns = append(p.patterns, rgx)
+	}
+	return p, nil
+}
+
+func (p *PathFilterProcessor) OnStart(_ context.Context, _ motel.Span) {}
+
+func (p *PathFilterProcessor) OnEnd(span motel.Span) motel.Span {
+	if span.SpanKind() != trace.SpanKindServer {
+		return span
+	}
+
+	// request span names are formatted as "METHOD path"
+	path := span.Name()
+	if idx := strings.Index(path, " "); idx >= 0 {
+		path = path[idx+1:]
+	}
+	for _, rgx := range p.patterns {
+		if rgx.MatchString(path) {
+			return nil
+		}
+	}
+	return span
+}
+
+// RenameProcessor renames spans, the rename function receives the span and
+// returns the new name
+type RenameProcessor struct {
+	rename func(span motel.Span) string
+}
+
+var _ ISpanProcessor = (*RenameProcessor)(nil)
+
+// NewRenameProcessor constructs a rename processor
+func NewRenameProcessor(
+	rename func(span motel.Span) string,
+) *RenameProcessor {
+	return &RenameProcessor{
+		rename: rename,
+	}
+}
+
+func (p *RenameProcessor) OnStart(_ context.Context, _ motel.Span) {}
+
+func (p *RenameProcessor) OnEnd(span motel.Span) motel.Span {
+	name := p.rename(span)
+	if name == span.Name() {
+		return span
+	}
+	return &renamedSpan{
+		Span: span,
+		name: name,
+	}
+}
+
+// renamedSpan overrides the name of a motel span
+type renamedSpan struct {
+	motel.Span
+	name string
+}
+
+func (s *renamedSpan) Name() string {
+	return s.name
+}
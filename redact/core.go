@@ -0,0 +1,65 @@
+package redact
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// WrapCore creates a zap core wrapper that redacts fields before they are
+// written, use it with zap.WrapCore
+func WrapCore(r *Redactor) func(zapcore.Core) zapcore.Core {
+	return func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{
+			Core: core,
+			rdc:  r,
+		}
+	}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	rdc *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{
+		Core: c.Core.With(c.redact(fields)),
+		rdc:  c.rdc,
+	}
+}
+
+func (c *redactingCore) Check(
+	ent zapcore.Entry,
+	ce *zapcore.CheckedEntry,
+) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(
+	ent zapcore.Entry,
+	fields []zapcore.Field,
+) error {
+	return c.Core.Write(ent, c.redact(fields))
+}
+
+// Redacts string fields, fields of other types are replaced entirely if
+// their key is denied
+func (c *redactingCore) redact(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch {
+		case f.Type == zapcore.StringType:
+			f.String = c.rdc.Redact(f.Key, f.String)
+		case c.rdc.IsDenied(f.Key):
+			f = zapcore.Field{
+				Key:    f.Key,
+				Type:   zapcore.StringType,
+				String: c.rdc.placeholder,
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+// Package redact scrubs sensitive values from span attributes and log fields
+// before they leave the process
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultPlaceholder replaces redacted values when hashing is disabled
+const DefaultPlaceholder = "[REDACTED]"
+
+// Options defines the redaction rules, keys are matched case insensitively
+type Options struct {
+	// DenyKeys values of these keys are redacted entirely
+	DenyKeys []string
+	// ValuePatterns regular expressions, matching parts of any value are
+	// redacted
+	ValuePatterns []string
+	// QueryParams query parameters that are scrubbed from url values, "*"
+	// scrubs every parameter
+	QueryParams []string
+	// IPKeys values of these keys are treated as ip addresses and truncated
+	// (/24 for ipv4 and /48 for ipv6)
+	IPKeys []string
+	// Hash replaces redacted values with a truncated sha256 hash instead of
+	// the placeholder so values can still be correlated
+	Hash bool
+	// HashSalt is prepended to values before hashing
+	HashSalt string
+	// Placeholder overrides DefaultPlaceholder
+	Placeholder string
+}
+
+// Redactor applies the redaction rules to key value pairs
+type Redactor struct {
+	denyKeys    map[string]struct{}
+	ipKeys      map[string]struct{}
+	patterns    []*regexp.Regexp
+	queryParams map[string]struct{}
+	allParams   bool
+	hash        bool
+	salt        string
+	placeholder string
+}
+
+// NewRedactor constructs a redactor, returns an error if any of the value
+// patterns fail to compile
+func NewRedactor(opts *Options) (*Redactor, error) {
+	r := &Redactor{
+		denyKeys:    toSet(opts.DenyKeys),
+		ipKeys:      toSet(opts.IPKeys),
+		queryParams: toSet(opts.QueryParams),
+		hash:        opts.Hash,
+		salt:        opts.HashSalt,
+		placeholder: opts.Placeholder,
+	}
+	if r.placeholder == "" {
+		r.placeholder = DefaultPlaceholder
+	}
+	if _, ok := r.queryParams["*"]; ok {
+		r.allParams = true
+	}
+
+	for _, p := range opts.ValuePatterns {
+		rgx, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, rgx)
+	}
+	return r, nil
+}
+
+// IsDenied checks if the value of a key should be redacted entirely
+func (r *Redactor) IsDenied(key string) bool {
+	_, ok := r.denyKeys[strings.ToLower(key)]
+	return ok
+}
+
+// Redact returns the value with all applicable rules applied
+func (r *Redactor) Redact(key string, value string) string {
+	if value == "" {
+		return value
+	}
+	lkey := strings.ToLower(key)
+	if _, ok := r.denyKeys[lkey]; ok {
+		return r.mask(value)
+	}
+	if _, ok := r.ipKeys[lkey]; ok {
+		value = truncateIP(value)
+	}
+	if len(r.queryParams) > 0 && strings.Contains(value, "?") {
+		value = r.scrubQuery(value)
+	}
+	for _, rgx := range r.patterns {
+		value = rgx.ReplaceAllStringFunc(value, r.mask)
+	}
+	return value
+}
+
+// Replaces the value with either the placeholder or its hash
+func (r *Redactor) mask(value string) string {
+	if !r.hash {
+		return r.placeholder
+	}
+	sum := sha256.Sum256([]byte(r.salt + value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Scrubs configured query parameters from the value, values that can't be
+// parsed are returned as is
+func (r *Redactor) scrubQuery(value string) string {
+	idx := strings.Index(value, "?")
+	query, err := url.ParseQuery(value[idx+1:])
+	if err != nil {
+		return value
+	}
+
+	changed := false
+	for key, vals := range query {
+		if _, ok := r.queryParams[strings.ToLower(key)]; !ok && !r.allParams {
+			continue
+		}
+		for i := range vals {
+			vals[i] = r.mask(vals[i])
+		}
+		changed = true
+	}
+	if !changed {
+		return value
+	}
+	return value[:idx+1] + query.Encode()
+}
+
+// Zeros the host part of an ip address, values that aren't ip addresses are
+// returned as is
+func truncateIP(value string) string {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		host, port = value, ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return value
+	}
+
+	var trunc string
+	if ip4 := ip.To4(); ip4 != nil {
+		trunc = ip4.Mask(net.CIDRMask(24, 32)).String()
+	} else {
+		trunc = ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+	if port != "" {
+		return net.JoinHostPort(trunc, port)
+	}
+	return trunc
+}
+
+func toSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,211 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		key   string
+		value string
+		want  string
+	}{
+		{
+			name:  "empty value",
+			opts:  Options{DenyKeys: []string{"password"}},
+			key:   "password",
+			value: "",
+			want:  "",
+		},
+		{
+			name:  "denied key",
+			opts:  Options{DenyKeys: []string{"password"}},
+			key:   "password",
+			value: "hunter2",
+			want:  DefaultPlaceholder,
+		},
+		{
+			name:  "denied key case insensitive",
+			opts:  Options{DenyKeys: []string{"Authorization"}},
+			key:   "AUTHORIZATION",
+			value: "Bearer abc",
+			want:  DefaultPlaceholder,
+		},
+		{
+			name:  "custom placeholder",
+			opts:  Options{DenyKeys: []string{"token"}, Placeholder: "***"},
+			key:   "token",
+			value: "abc",
+			want:  "***",
+		},
+		{
+			name:  "allowed key untouched",
+			opts:  Options{DenyKeys: []string{"password"}},
+			key:   "user",
+			value: "alice",
+			want:  "alice",
+		},
+		{
+			name:  "value pattern",
+			opts:  Options{ValuePatterns: []string{`\d{4}-\d{4}-\d{4}-\d{4}`}},
+			key:   "message",
+			value: "card 1234-5678-9012-3456 declined",
+			want:  "card [REDACTED] declined",
+		},
+		{
+			name:  "query param",
+			opts:  Options{QueryParams: []string{"token"}},
+			key:   "url",
+			value: "/path?token=abc&page=2",
+			want:  "/path?page=2&token=%5BREDACTED%5D",
+		},
+		{
+			name:  "query param case insensitive",
+			opts:  Options{QueryParams: []string{"token"}},
+			key:   "url",
+			value: "/path?Token=abc",
+			want:  "/path?Token=%5BREDACTED%5D",
+		},
+		{
+			name:  "query param not present",
+			opts:  Options{QueryParams: []string{"token"}},
+			key:   "url",
+			value: "/path?page=2&sort=asc",
+			want:  "/path?page=2&sort=asc",
+		},
+		{
+			name:  "all query params",
+			opts:  Options{QueryParams: []string{"*"}},
+			key:   "url",
+			value: "/path?a=1&b=2",
+			want:  "/path?a=%5BREDACTED%5D&b=%5BREDACTED%5D",
+		},
+		{
+			name:  "unparsable query kept",
+			opts:  Options{QueryParams: []string{"*"}},
+			key:   "url",
+			value: "/path?a=%zz",
+			want:  "/path?a=%zz",
+		},
+		{
+			name:  "ipv4 truncated",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "ip",
+			value: "192.168.10.42",
+			want:  "192.168.10.0",
+		},
+		{
+			name:  "ipv4 with port",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "ip",
+			value: "192.168.10.42:8080",
+			want:  "192.168.10.0:8080",
+		},
+		{
+			name:  "ipv6 truncated",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "ip",
+			value: "2001:db8:abcd:12:1:2:3:4",
+			want:  "2001:db8:abcd::",
+		},
+		{
+			name:  "ipv6 with port",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "ip",
+			value: "[2001:db8:abcd:12::1]:443",
+			want:  "[2001:db8:abcd::]:443",
+		},
+		{
+			name:  "non ip kept",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "ip",
+			value: "unknown",
+			want:  "unknown",
+		},
+		{
+			name:  "ip key only",
+			opts:  Options{IPKeys: []string{"ip"}},
+			key:   "other",
+			value: "192.168.10.42",
+			want:  "192.168.10.42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(&tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Redact(tt.key, tt.value); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactHash(t *testing.T) {
+	r, err := NewRedactor(&Options{
+		DenyKeys: []string{"email"},
+		Hash:     true,
+		HashSalt: "salt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := r.Redact("email", "alice@example.com")
+	b := r.Redact("email", "alice@example.com")
+	c := r.Redact("email", "bob@example.com")
+	if !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+16 {
+		t.Fatalf("unexpected hash format %q", a)
+	}
+	if a != b {
+		t.Error("expected equal values to hash equally")
+	}
+	if a == c {
+		t.Error("expected different values to hash differently")
+	}
+
+	unsalted, err := NewRedactor(&Options{
+		DenyKeys: []string{"email"},
+		Hash:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsalted.Redact("email", "alice@example.com") == a {
+		t.Error("expected the salt to change the hash")
+	}
+}
+
+func TestNewRedactorInvalidPattern(t *testing.T) {
+	_, err := NewRedactor(&Options{ValuePatterns: []string{"("}})
+	if err == nil {
+		t.Fatal("expected invalid pattern to fail")
+	}
+}
+
+func TestIsDenied(t *testing.T) {
+	r, err := NewRedactor(&Options{DenyKeys: []string{"Password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "password", want: true},
+		{key: "PASSWORD", want: true},
+		{key: "passwords", want: false},
+		{key: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := r.IsDenied(tt.key); got != tt.want {
+			t.Errorf("IsDenied(%q) expected %v, got %v", tt.key, tt.want, got)
+		}
+	}
+}